@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+var originalsActionComboBoxLists = []string{
+	"keep",
+	"move to folder",
+	"trash",
+	"rename",
+}
+var originalsActionComboBoxIdx int32 = 0
+var originalsActionToUse = "keep"
+
+var originalsFolder = "originals"
+var originalsRenamePattern = "{name}.done{ext}"
+var deleteLargerOutput bool
+var jobHookCommand string
+var revealOutput bool
+var batchHookCommand string
+
+// hookOutputSize is how many bytes of hook output are kept on job report
+const hookOutputSize = 4096
+
+// hookTimeout is how long a hook command may run before it is killed
+const hookTimeout = 30 * time.Minute
+
+// actionResult is outcome of a single post-conversion action, kept on job report
+type actionResult struct {
+	Action  string `json:"action"`
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+func actionSucceeded(action, message string) actionResult {
+	return actionResult{Action: action, Result: historyResultSuccess, Message: message}
+}
+
+func actionFailed(action string, err error) actionResult {
+	return actionResult{Action: action, Result: historyResultFailed, Message: err.Error()}
+}
+
+// isSingleOutputFile reports whether output is one file, not a pattern such as frames or streaming package
+func isSingleOutputFile(outputPath string) bool {
+	return !strings.Contains(outputPath, "%")
+}
+
+// moveFile renames src to dst, falling back to copy and remove across file systems
+func moveFile(src, dst string) error {
+	if _, err := os.Stat(dst); nil == err {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	if err := os.Rename(src, dst); nil == err {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if nil != err {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(0644))
+	if nil != err {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); nil != err {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); nil != err {
+		os.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
+
+// trashFile moves path into trash of the desktop, so that it can be restored
+func trashFile(path string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", `on run argv
+tell application "Finder" to delete POSIX file (item 1 of argv)
+end run`, path)
+	case "windows":
+		// single quoted powershell string has no escape but doubled quote
+		quoted := "'" + strings.ReplaceAll(path, "'", "''") + "'"
+		cmd = exec.Command("powershell", "-NoProfile", "-Command",
+			fmt.Sprintf("Add-Type -AssemblyName Microsoft.VisualBasic; [Microsoft.VisualBasic.FileIO.FileSystem]::DeleteFile(%s, 'OnlyErrorDialogs', 'SendToRecycleBin')", quoted))
+	default:
+		cmd = exec.Command("gio", "trash", path)
+	}
+
+	if output, err := cmd.CombinedOutput(); nil != err {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// revealInFileManager opens file manager showing path, or its directory when path is not a single file
+func revealInFileManager(path string) error {
+	dir := filepath.Dir(path)
+	if _, err := os.Stat(path); nil != err {
+		path = ""
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		if "" != path {
+			cmd = exec.Command("open", "-R", path)
+		} else {
+			cmd = exec.Command("open", dir)
+		}
+	case "windows":
+		if "" != path {
+			cmd = exec.Command("explorer", "/select,"+path)
+		} else {
+			cmd = exec.Command("explorer", dir)
+		}
+		// explorer exits with 1 even on success
+		cmd.Start()
+		return nil
+	default:
+		cmd = exec.Command("xdg-open", dir)
+	}
+
+	return cmd.Run()
+}
+
+// expandTemplate replaces {placeholder} in s with values, in a single pass so that values are never expanded again
+func expandTemplate(s string, values map[string]string) string {
+	var oldnew []string
+	for key, value := range values {
+		oldnew = append(oldnew, "{"+key+"}", value)
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(s)
+}
+
+// runHook runs user command with templated arguments, without shell so that paths need no quoting.
+// An argument which is exactly a key of lists (e.g. "{outputs}") is expanded into multiple arguments.
+// Command is killed when ctx is cancelled or it runs longer than hookTimeout.
+func runHook(ctx context.Context, action, command string, values map[string]string, lists map[string][]string) actionResult {
+	args, err := splitArgs(command)
+	if nil != err {
+		return actionFailed(action, err)
+	}
+	if 0 == len(args) {
+		return actionFailed(action, fmt.Errorf("command is empty"))
+	}
+
+	var expanded []string
+	for _, arg := range args {
+		if list, ok := lists[arg]; ok {
+			expanded = append(expanded, list...)
+			continue
+		}
+		expanded = append(expanded, expandTemplate(arg, values))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, expanded[0], expanded[1:]...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	ret := actionResult{Action: action, Result: historyResultSuccess, Message: commandLineString(expanded)}
+	if err := cmd.Run(); nil != err {
+		ret.Result = historyResultFailed
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			ret.Message = fmt.Sprintf("%s: timed out after %s", ret.Message, hookTimeout)
+		case context.Canceled:
+			ret.Result = historyResultCancelled
+			ret.Message = fmt.Sprintf("%s: cancelled", ret.Message)
+		default:
+			ret.Message = fmt.Sprintf("%s: %s", ret.Message, err)
+		}
+	}
+
+	ret.Output = output.String()
+	if hookOutputSize < len(ret.Output) {
+		ret.Output = ret.Output[len(ret.Output)-hookOutputSize:]
+	}
+
+	return ret
+}
+
+// originalsAction moves, trashes or renames source of a successful job
+func originalsAction(s conversionSettings, inputPath string) actionResult {
+	action := fmt.Sprintf("originals: %s", s.OriginalsAction)
+	dir := filepath.Dir(inputPath)
+	ext := filepath.Ext(inputPath)
+	name := strings.TrimSuffix(filepath.Base(inputPath), ext)
+
+	switch s.OriginalsAction {
+	case "move to folder":
+		folder := s.OriginalsFolder
+		if "" == strings.TrimSpace(folder) {
+			return actionFailed(action, fmt.Errorf("folder is empty"))
+		}
+		if !filepath.IsAbs(folder) {
+			folder = filepath.Join(dir, folder)
+		}
+		if err := os.MkdirAll(folder, os.FileMode(0755)); nil != err {
+			return actionFailed(action, err)
+		}
+
+		dst := filepath.Join(folder, filepath.Base(inputPath))
+		if err := moveFile(inputPath, dst); nil != err {
+			return actionFailed(action, err)
+		}
+		return actionSucceeded(action, dst)
+	case "trash":
+		if err := trashFile(inputPath); nil != err {
+			return actionFailed(action, err)
+		}
+		return actionSucceeded(action, inputPath)
+	case "rename":
+		newName := expandTemplate(s.OriginalsRenamePattern, map[string]string{"name": name, "ext": ext})
+		if "" == newName || strings.ContainsAny(newName, `/\`) {
+			return actionFailed(action, fmt.Errorf("invalid file name %q", newName))
+		}
+
+		dst := filepath.Join(dir, newName)
+		if err := moveFile(inputPath, dst); nil != err {
+			return actionFailed(action, err)
+		}
+		return actionSucceeded(action, dst)
+	}
+
+	return actionSucceeded(action, "")
+}
+
+// runJobActions runs post-job actions configured in settings of the job, in order:
+// deleting larger output, handling originals, then hook command, which is killed when ctx is cancelled
+func runJobActions(ctx context.Context, s conversionSettings, entry historyEntry) []actionResult {
+	var results []actionResult
+	succeeded := historyResultSuccess == entry.Result
+
+	outputDeleted := false
+	if succeeded && s.DeleteLargerOutput && isSingleOutputFile(entry.OutputPath) {
+		inputStat, inputErr := os.Stat(entry.InputPath)
+		outputStat, outputErr := os.Stat(entry.OutputPath)
+		if nil == inputErr && nil == outputErr && outputStat.Size() > inputStat.Size() {
+			if err := os.Remove(entry.OutputPath); nil != err {
+				results = append(results, actionFailed("delete larger output", err))
+			} else {
+				outputDeleted = true
+				results = append(results, actionSucceeded("delete larger output", fmt.Sprintf("%d bytes > %d bytes", outputStat.Size(), inputStat.Size())))
+			}
+		}
+	}
+
+	// original is the only copy left when output is deleted
+	if succeeded && !outputDeleted && "keep" != s.OriginalsAction && "" != s.OriginalsAction {
+		results = append(results, originalsAction(s, entry.InputPath))
+	}
+
+	if "" != strings.TrimSpace(s.JobHook) {
+		output := entry.OutputPath
+		if outputDeleted {
+			output = ""
+		}
+		results = append(results, runHook(ctx, "job hook", s.JobHook, map[string]string{
+			"input":      entry.InputPath,
+			"output":     output,
+			"input_dir":  filepath.Dir(entry.InputPath),
+			"output_dir": filepath.Dir(entry.OutputPath),
+			"result":     entry.Result,
+		}, nil))
+	}
+
+	return results
+}
+
+// runBatchActions runs post-batch actions once every job of a batch is finished, hook is killed when ctx is cancelled
+func runBatchActions(ctx context.Context, s conversionSettings, batch []job) []actionResult {
+	var results []actionResult
+
+	var inputs, outputs []string
+	failed := 0
+	lastOutput := ""
+	for _, j := range batch {
+		inputs = append(inputs, j.InputPath)
+		if historyResultSuccess == j.Status {
+			outputs = append(outputs, j.OutputPath)
+			lastOutput = j.OutputPath
+		} else {
+			failed++
+		}
+	}
+
+	if s.RevealOutput && "" != lastOutput {
+		if err := revealInFileManager(lastOutput); nil != err {
+			results = append(results, actionFailed("reveal output", err))
+		} else {
+			results = append(results, actionSucceeded("reveal output", lastOutput))
+		}
+	}
+
+	if "" != strings.TrimSpace(s.BatchHook) {
+		results = append(results, runHook(ctx, "batch hook", s.BatchHook, map[string]string{
+			"count":      strconv.Itoa(len(batch)),
+			"failed":     strconv.Itoa(failed),
+			"output_dir": filepath.Dir(lastOutput),
+		}, map[string][]string{
+			"{inputs}":  inputs,
+			"{outputs}": outputs,
+		}))
+	}
+
+	return results
+}
+
+// actionFailures returns messages of failed actions, to show on GUI
+func actionFailures(results []actionResult) []string {
+	var ret []string
+	for _, result := range results {
+		if historyResultFailed == result.Result {
+			ret = append(ret, fmt.Sprintf("%s failed: %s", result.Action, result.Message))
+		}
+	}
+
+	return ret
+}
+
+func actionsLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Checkbox("delete output if larger than input", &deleteLargerOutput),
+		g.Row(
+			g.Label("originals"),
+			g.Dummy(10, 0),
+			g.Combo("##originalsaction", originalsActionComboBoxLists[originalsActionComboBoxIdx], originalsActionComboBoxLists, &originalsActionComboBoxIdx).Size(140).OnChange(func() {
+				originalsActionToUse = originalsActionComboBoxLists[originalsActionComboBoxIdx]
+			}),
+		),
+	}
+
+	switch originalsActionToUse {
+	case "move to folder":
+		widgets = append(widgets, g.InputText(&originalsFolder).Hint("folder, relative to the original").Size(-1))
+	case "rename":
+		widgets = append(widgets, g.InputText(&originalsRenamePattern).Hint("{name}.done{ext}").Size(-1))
+	}
+
+	widgets = append(widgets, []g.Widget{
+		g.InputText(&jobHookCommand).Hint("after each file, e.g. upload.sh {output} {result}").Size(-1),
+		g.Checkbox("reveal output in file manager when all done", &revealOutput),
+		g.InputText(&batchHookCommand).Hint("when all done, e.g. notify.sh {count} {failed} {outputs}").Size(-1),
+	}...)
+
+	return []g.Widget{
+		g.TreeNode("after conversion").Layout(widgets...),
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var advancedMode bool
+var advancedInputArgs string
+var advancedOutputArgs string
+var advancedVideoFilter string
+var advancedAudioFilter string
+
+// kwargAliases maps ffmpeg option names to the canonical name used in generated kwargs
+var kwargAliases = map[string]string{
+	"vcodec":  "c:v",
+	"codec:v": "c:v",
+	"acodec":  "c:a",
+	"codec:a": "c:a",
+	"vf":      "filter:v",
+	"af":      "filter:a",
+	"ab":      "b:a",
+	"codec":   "c",
+}
+
+// kwargsReserved are options that are managed by the converter itself
+var kwargsReserved = map[string]bool{
+	"i":        true,
+	"filename": true,
+	"format":   true,
+}
+
+var negativeNumberRegexp = regexp.MustCompile(`^-[0-9.]`)
+
+// splitArgs tokenizes s into arguments like a POSIX shell does, without any expansion.
+// Backslash only escapes quotes, whitespace and backslash itself, so that windows paths are kept as is.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inWord := false
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if '\\' == r && '\'' != quote && i+1 < len(runes) {
+			next := runes[i+1]
+			if '"' == next || '\\' == next || ('"' != quote && ('\'' == next || unicode.IsSpace(next))) {
+				current.WriteRune(next)
+				inWord = true
+				i++
+				continue
+			}
+		}
+
+		switch {
+		case 0 != quote:
+			if quote == r {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case '\'' == r || '"' == r:
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if 0 != quote {
+		return nil, fmt.Errorf("unterminated quote %c in: %s", quote, s)
+	}
+
+	if inWord {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// argsToKwargs converts tokenized ffmpeg options into kwargs, repeated options are kept in order
+func argsToKwargs(args []string) (ffmpeg.KwArgs, error) {
+	kwargs := ffmpeg.KwArgs{}
+
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") || 1 == len(args[i]) {
+			return nil, fmt.Errorf("expected option starting with '-', got %q", args[i])
+		}
+
+		key := strings.TrimPrefix(args[i], "-")
+		if alias, ok := kwargAliases[key]; ok {
+			key = alias
+		}
+
+		if kwargsReserved[key] {
+			return nil, fmt.Errorf("option -%s is managed by converter, cannot be given", key)
+		}
+
+		value := ""
+		if i+1 < len(args) && (!strings.HasPrefix(args[i+1], "-") || negativeNumberRegexp.MatchString(args[i+1])) {
+			value = args[i+1]
+			i++
+		}
+
+		switch prev := kwargs[key].(type) {
+		case nil:
+			kwargs[key] = value
+		case string:
+			kwargs[key] = []string{prev, value}
+		case []string:
+			kwargs[key] = append(prev, value)
+		}
+	}
+
+	return kwargs, nil
+}
+
+// mergeKwargs merges extra into base, extra wins. Returns warnings for every overridden option.
+func mergeKwargs(base, extra ffmpeg.KwArgs) []string {
+	var warnings []string
+
+	var keys []string
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := extra[key]
+
+		// -c applies to every stream, so it conflicts with stream specific codecs
+		if "c" == key {
+			for _, streamKey := range []string{"c:v", "c:a"} {
+				if prev, ok := base[streamKey]; ok {
+					warnings = append(warnings, fmt.Sprintf("-c %v overrides generated -%s %v", value, streamKey, prev))
+					delete(base, streamKey)
+				}
+			}
+		}
+
+		if prev, ok := base[key]; ok && fmt.Sprint(prev) != fmt.Sprint(value) {
+			warnings = append(warnings, fmt.Sprintf("-%s %v overrides generated -%s %v", key, value, key, prev))
+		}
+
+		base[key] = value
+	}
+
+	return warnings
+}
+
+// appendFilterChain appends custom filter chain to generated one, so that both are applied in order
+func appendFilterChain(kwargs ffmpeg.KwArgs, key, chain string) {
+	chain = strings.TrimSpace(chain)
+	if "" == chain {
+		return
+	}
+
+	if prev, ok := kwargs[key].(string); ok && "" != prev {
+		chain = prev + "," + chain
+	}
+
+	kwargs[key] = chain
+}
+
+// mergeAdvancedKwargs merges advanced options into generated input and output kwargs.
+// Returned warnings describe conflicts between generated and advanced options.
+func mergeAdvancedKwargs(s conversionSettings, inputKwargs, outputKwargs ffmpeg.KwArgs) ([]string, error) {
+	var warnings []string
+
+	appendFilterChain(outputKwargs, "filter:v", s.AdvancedVideoFilter)
+	appendFilterChain(outputKwargs, "filter:a", s.AdvancedAudioFilter)
+
+	for _, extra := range []struct {
+		args   string
+		kwargs ffmpeg.KwArgs
+	}{
+		{s.AdvancedInputArgs, inputKwargs},
+		{s.AdvancedOutputArgs, outputKwargs},
+	} {
+		tokens, err := splitArgs(extra.args)
+		if nil != err {
+			return nil, err
+		}
+
+		extraKwargs, err := argsToKwargs(tokens)
+		if nil != err {
+			return nil, err
+		}
+
+		warnings = append(warnings, mergeKwargs(extra.kwargs, extraKwargs)...)
+	}
+
+	return warnings, nil
+}
+
+func advancedLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Checkbox("advanced", &advancedMode),
+	}
+
+	if !advancedMode {
+		return widgets
+	}
+
+	widgets = append(widgets, []g.Widget{
+		g.InputText(&advancedInputArgs).Hint("extra input args, e.g. -ss 10").Size(-1),
+		g.InputText(&advancedOutputArgs).Hint("extra output args, e.g. -crf 23 -preset slow").Size(-1),
+		g.InputText(&advancedVideoFilter).Hint("video filter chain (-vf)").Size(-1),
+		g.InputText(&advancedAudioFilter).Hint("audio filter chain (-af)").Size(-1),
+	}...)
+
+	return widgets
+}
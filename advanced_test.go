@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"-crf 23 -preset slow", []string{"-crf", "23", "-preset", "slow"}},
+		{"  -crf\t23\n", []string{"-crf", "23"}},
+		{`-metadata "title=My Video"`, []string{"-metadata", "title=My Video"}},
+		{`-metadata 'comment=say "hi"'`, []string{"-metadata", `comment=say "hi"`}},
+		{`-metadata "comment=say \"hi\""`, []string{"-metadata", `comment=say "hi"`}},
+		{`-metadata title=My\ Video`, []string{"-metadata", "title=My Video"}},
+		{`-vf 'drawtext=text=\n'`, []string{"-vf", `drawtext=text=\n`}},
+		{`-i C:\Videos\input.mp4`, []string{"-i", `C:\Videos\input.mp4`}},
+		{`-i "C:\Program Files\a.mp4"`, []string{"-i", `C:\Program Files\a.mp4`}},
+		{`-title ""`, []string{"-title", ""}},
+		{`a"b"'c'`, []string{"abc"}},
+	}
+
+	for _, test := range tests {
+		actual, err := splitArgs(test.input)
+		if nil != err {
+			t.Errorf("splitArgs(%q): %s", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("splitArgs(%q) = %q, expected %q", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestSplitArgsUnterminatedQuote(t *testing.T) {
+	for _, input := range []string{`-metadata "title=x`, `-vf 'scale=1280:-2`, `"a\"`} {
+		if _, err := splitArgs(input); nil == err {
+			t.Errorf("splitArgs(%q) is accepted, expected unterminated quote error", input)
+		}
+	}
+}
+
+func TestArgsToKwargs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected ffmpeg.KwArgs
+	}{
+		{nil, ffmpeg.KwArgs{}},
+		{[]string{"-crf", "23"}, ffmpeg.KwArgs{"crf": "23"}},
+		{[]string{"-an", "-sn"}, ffmpeg.KwArgs{"an": "", "sn": ""}},
+		{[]string{"-an", "-crf", "23"}, ffmpeg.KwArgs{"an": "", "crf": "23"}},
+		// negative numbers are values, not options
+		{[]string{"-itsoffset", "-1.5"}, ffmpeg.KwArgs{"itsoffset": "-1.5"}},
+		{[]string{"-ss", "-.5", "-y"}, ffmpeg.KwArgs{"ss": "-.5", "y": ""}},
+		{[]string{"-af", "volume=-3dB"}, ffmpeg.KwArgs{"filter:a": "volume=-3dB"}},
+		// repeated options keep every value in order
+		{[]string{"-map", "0:v", "-map", "0:a:1"}, ffmpeg.KwArgs{"map": []string{"0:v", "0:a:1"}}},
+		{[]string{"-map", "0", "-map", "-0:s", "-map", "1:a"}, ffmpeg.KwArgs{"map": []string{"0", "-0:s", "1:a"}}},
+		// aliases become names of generated kwargs
+		{[]string{"-vcodec", "libx264", "-acodec", "aac"}, ffmpeg.KwArgs{"c:v": "libx264", "c:a": "aac"}},
+		{[]string{"-vf", "hflip", "-ab", "128k"}, ffmpeg.KwArgs{"filter:v": "hflip", "b:a": "128k"}},
+		{[]string{"-codec", "copy"}, ffmpeg.KwArgs{"c": "copy"}},
+	}
+
+	for _, test := range tests {
+		actual, err := argsToKwargs(test.args)
+		if nil != err {
+			t.Errorf("argsToKwargs(%q): %s", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.expected, actual) {
+			t.Errorf("argsToKwargs(%q) = %v, expected %v", test.args, actual, test.expected)
+		}
+	}
+}
+
+func TestArgsToKwargsRejects(t *testing.T) {
+	tests := [][]string{
+		{"23"},
+		{"-crf", "23", "slow"},
+		{"-"},
+		{"-i", "other.mp4"},
+		{"-format", "mp4"},
+		{"-filename", "out.mp4"},
+	}
+
+	for _, args := range tests {
+		if _, err := argsToKwargs(args); nil == err {
+			t.Errorf("argsToKwargs(%q) is accepted, expected error", args)
+		}
+	}
+}
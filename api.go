@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var serveAPI bool
+var headless bool
+var apiListenAddr = "127.0.0.1:8765"
+var apiToken string
+var saveToken bool
+var apiHelperMsg string
+
+// submitJobRequest is body of POST /api/jobs, preset is optional and falls back to current GUI settings
+type submitJobRequest struct {
+	Path   string `json:"path"`
+	Preset string `json:"preset"`
+}
+
+// startAPIServer listens on apiListenAddr and serves API in background
+func startAPIServer() error {
+	listener, err := net.Listen("tcp", apiListenAddr)
+	if nil != err {
+		return err
+	}
+
+	apiHelperMsg = fmt.Sprintf("api: http://%s", listener.Addr())
+	if host, _, err := net.SplitHostPort(listener.Addr().String()); nil == err && !net.ParseIP(host).IsLoopback() && "" == apiToken {
+		apiHelperMsg += " (warning: reachable from network without token)"
+	}
+
+	server := &http.Server{
+		Handler:           apiHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+
+	return nil
+}
+
+func apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/jobs", handleJobs)
+	mux.HandleFunc("/api/jobs/", handleJob)
+	mux.HandleFunc("/api/events", handleEvents)
+	mux.HandleFunc("/api/presets", handlePresets)
+
+	return rejectForeignRequests(requireToken(mux))
+}
+
+// isAllowedHost reports whether host (without port) names this server: loopback, or address it listens on.
+// Any host is allowed when listening on every interface, token has to protect such server.
+func isAllowedHost(host string) bool {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if "localhost" == strings.ToLower(host) {
+		return true
+	}
+	if ip := net.ParseIP(host); nil != ip && ip.IsLoopback() {
+		return true
+	}
+
+	listenHost, _, err := net.SplitHostPort(apiListenAddr)
+	if nil != err {
+		return false
+	}
+	if ip := net.ParseIP(listenHost); "" == listenHost || (nil != ip && ip.IsUnspecified()) {
+		return true
+	}
+
+	return strings.EqualFold(host, listenHost)
+}
+
+// rejectForeignRequests protects API from web pages opened in a browser on the same machine:
+// Host must name this server (against DNS rebinding), and requests changing state must not come
+// from another origin (against cross-site form posts).
+func rejectForeignRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); nil == err {
+			host = h
+		}
+		if !isAllowedHost(host) {
+			writeAPIError(w, http.StatusForbidden, fmt.Sprintf("host not allowed: %s", r.Host))
+			return
+		}
+
+		if http.MethodGet != r.Method && http.MethodHead != r.Method {
+			if origin := r.Header.Get("Origin"); "" != origin {
+				if u, err := url.Parse(origin); nil != err || !strings.EqualFold(u.Host, r.Host) {
+					writeAPIError(w, http.StatusForbidden, fmt.Sprintf("origin not allowed: %s", origin))
+					return
+				}
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireToken checks bearer token when one is configured.
+// Token is accepted as query parameter too, since browser EventSource cannot set headers.
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "" != apiToken {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if "" == token {
+				token = r.URL.Query().Get("token")
+			}
+			if 1 != subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) {
+				writeAPIError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
+
+// handleJobs lists jobs on GET, submits a job on POST
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAPIJSON(w, http.StatusOK, listJobs())
+	case http.MethodPost:
+		if !isFfmpegReady {
+			writeAPIError(w, http.StatusServiceUnavailable, "ffmpeg is not ready yet")
+			return
+		}
+
+		// HTML forms cannot send JSON, so that other sites cannot submit jobs without CORS preflight
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); nil != err || "application/json" != mediaType {
+			writeAPIError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		var req submitJobRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); nil != err {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+			return
+		}
+
+		filestat, err := os.Stat(req.Path)
+		if nil != err || filestat.IsDir() {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("file not found: %s", req.Path))
+			return
+		}
+		videoPath := norm.NFC.String(req.Path)
+
+		settings := publishedSettings()
+		if "" != req.Preset {
+			preset, ok := presetOf(req.Preset)
+			if !ok {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("preset not found: %s", req.Preset))
+				return
+			}
+			settings = preset
+		}
+
+		probe, err := detectWithFfprobe(videoPath)
+		if nil != err {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("not a video file: %s", err))
+			return
+		}
+
+		submitted, err := submitJob(videoPath, probe, settings, req.Preset, "")
+		if nil != err {
+			writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+
+		writeAPIJSON(w, http.StatusCreated, submitted)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleJob serves /api/jobs/{id}, /api/jobs/{id}/report and /api/jobs/{id}/cancel
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/"), "/")
+
+	j, ok := findJob(parts[0])
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	action := ""
+	if 1 < len(parts) {
+		action = parts[1]
+	}
+
+	switch {
+	case "" == action && http.MethodGet == r.Method:
+		writeAPIJSON(w, http.StatusOK, jobSnapshot(j))
+	case "" == action && http.MethodDelete == r.Method, "cancel" == action && http.MethodPost == r.Method:
+		writeAPIJSON(w, http.StatusOK, cancelJob(j))
+	case "report" == action && http.MethodGet == r.Method:
+		writeAPIJSON(w, http.StatusOK, reportOf(j))
+	default:
+		writeAPIError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// handleEvents streams job snapshots as server-sent events, optionally only of job given by id parameter
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	ch := subscribeJobs()
+	defer unsubscribeJobs(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(snapshot job) {
+		if "" != id && id != snapshot.ID {
+			return
+		}
+		data, _ := json.Marshal(snapshot)
+		fmt.Fprintf(w, "event: job\ndata: %s\n\n", data)
+		flusher.Flush()
+	}
+
+	// current state first, so that client does not need to list jobs separately
+	for _, snapshot := range listJobs() {
+		send(snapshot)
+	}
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case snapshot := <-ch:
+			send(snapshot)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func handlePresets(w http.ResponseWriter, r *http.Request) {
+	if http.MethodGet != r.Method {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeAPIJSON(w, http.StatusOK, listPresetNames())
+}
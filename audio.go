@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var audioNormalize = false
+var targetLoudness float32 = -16
+var targetTruePeak float32 = -1.5
+var targetLoudnessRange float32 = 11
+var volumeGain float32 = 0
+
+var audioChannelsComboBoxLists = []string{
+	"original",
+	"stereo",
+	"mono",
+}
+var audioChannelsComboBoxIdx int32 = 0
+var audioChannelsToUse = "original"
+
+var audioSampleRateComboBoxLists = []string{
+	"original",
+	"44100",
+	"48000",
+}
+var audioSampleRateComboBoxIdx int32 = 0
+var audioSampleRateToUse = "original"
+
+// loudnormMeasurement is what loudnorm filter prints on first pass, values are kept as printed
+type loudnormMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// loudnormMeasurements holds first pass result for each video, used by second pass.
+// Worker writes it while GUI reads it for command preview, so it is accessed under mutex.
+var loudnormMeasurementsMutex sync.Mutex
+var loudnormMeasurements = map[string]loudnormMeasurement{}
+
+func loudnormMeasurementOf(videoPath string) (loudnormMeasurement, bool) {
+	loudnormMeasurementsMutex.Lock()
+	defer loudnormMeasurementsMutex.Unlock()
+
+	measurement, ok := loudnormMeasurements[videoPath]
+	return measurement, ok
+}
+
+func setLoudnormMeasurement(videoPath string, measurement loudnormMeasurement) {
+	loudnormMeasurementsMutex.Lock()
+	loudnormMeasurements[videoPath] = measurement
+	loudnormMeasurementsMutex.Unlock()
+}
+
+func loudnormTarget(s conversionSettings) string {
+	return fmt.Sprintf("I=%.1f:TP=%.1f:LRA=%.1f", s.TargetLoudness, s.TargetTruePeak, s.TargetLoudnessRange)
+}
+
+// parseLoudnormOutput extracts JSON printed by loudnorm filter at the end of ffmpeg stderr
+func parseLoudnormOutput(output string) (loudnormMeasurement, error) {
+	var ret loudnormMeasurement
+
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if 0 > start || end < start {
+		return ret, fmt.Errorf("loudnorm output not found")
+	}
+
+	if err := json.Unmarshal([]byte(output[start:end+1]), &ret); nil != err {
+		return ret, err
+	}
+
+	if "" == ret.InputI || "" == ret.InputTP || "" == ret.InputLRA || "" == ret.InputThresh {
+		return ret, fmt.Errorf("loudnorm output is incomplete")
+	}
+
+	// silent input is measured as -inf, linear normalization cannot be applied on it
+	if strings.Contains(ret.InputI, "inf") {
+		return ret, fmt.Errorf("input is silent")
+	}
+
+	return ret, nil
+}
+
+// measureLoudness runs first loudnorm pass on videoPath, returns measurement and history result with message
+func measureLoudness(s conversionSettings, videoPath string) (loudnormMeasurement, string, string) {
+	var stderr bytes.Buffer
+
+	ffmpegCmd := exec.Command("ffmpeg",
+		"-hide_banner", "-nostats",
+		"-i", videoPath,
+		"-vn", "-sn", "-dn",
+		"-af", fmt.Sprintf("loudnorm=%s:print_format=json", loudnormTarget(s)),
+		"-f", "null", "-",
+	)
+	ffmpegCmd.Stderr = io.MultiWriter(&stderr, &convertingFFmpegOutput)
+
+	result, message := runFfmpegCmd(ffmpegCmd, videoPath)
+	if historyResultSuccess != result {
+		return loudnormMeasurement{}, result, message
+	}
+
+	measurement, err := parseLoudnormOutput(stderr.String())
+	if nil != err {
+		return measurement, historyResultFailed, err.Error()
+	}
+
+	return measurement, historyResultSuccess, ""
+}
+
+// audioSampleRate returns sample rate of first audio stream, empty if there is no audio
+func (o ffprobeOutput) audioSampleRate() string {
+	for _, stream := range o.Streams {
+		if "audio" == stream.CodecType {
+			return stream.SampleRate
+		}
+	}
+
+	return ""
+}
+
+// audioKwargs adds audio filter and format options for videoPath, according to s
+func audioKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath string) {
+	var filters []string
+
+	if s.AudioNormalize {
+		if measurement, ok := loudnormMeasurementOf(videoPath); ok {
+			filters = append(filters, fmt.Sprintf("loudnorm=%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+				loudnormTarget(s),
+				measurement.InputI,
+				measurement.InputTP,
+				measurement.InputLRA,
+				measurement.InputThresh,
+				measurement.TargetOffset,
+			))
+		} else {
+			// not measured yet (e.g. preview of command), fall back to single pass
+			filters = append(filters, fmt.Sprintf("loudnorm=%s", loudnormTarget(s)))
+		}
+	} else if 0 != s.VolumeGain {
+		filters = append(filters, fmt.Sprintf("volume=%.1fdB", s.VolumeGain))
+	}
+
+	if 0 < len(filters) {
+		args["filter:a"] = strings.Join(filters, ",")
+	}
+
+	switch s.AudioChannels {
+	case "stereo":
+		args["ac"] = "2"
+	case "mono":
+		args["ac"] = "1"
+	}
+
+	if "original" != s.AudioSampleRate {
+		args["ar"] = s.AudioSampleRate
+	} else if s.AudioNormalize {
+		// loudnorm resamples to 192kHz internally, so bring it back to source rate
+		probe, _ := videoProbeOf(videoPath)
+		sampleRate := probe.audioSampleRate()
+		if "" == sampleRate {
+			sampleRate = "48000"
+		}
+		args["ar"] = sampleRate
+	}
+}
+
+func audioLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Checkbox("normalize loudness (EBU R128, two pass)", &audioNormalize),
+	}
+
+	if audioNormalize {
+		widgets = append(widgets, g.Row(
+			g.InputFloat(&targetLoudness).Label("LUFS").Format("%.1f").Size(60),
+			g.InputFloat(&targetTruePeak).Label("TP").Format("%.1f").Size(60),
+			g.InputFloat(&targetLoudnessRange).Label("LRA").Format("%.1f").Size(60),
+		))
+	} else {
+		widgets = append(widgets, g.InputFloat(&volumeGain).Label("volume gain (dB)").Format("%.1f").Size(80))
+	}
+
+	widgets = append(widgets, g.Row(
+		g.Label("channels"),
+		g.Combo("##audiochannels", audioChannelsComboBoxLists[audioChannelsComboBoxIdx], audioChannelsComboBoxLists, &audioChannelsComboBoxIdx).Size(90).OnChange(func() {
+			audioChannelsToUse = audioChannelsComboBoxLists[audioChannelsComboBoxIdx]
+		}),
+		g.Label("sample rate"),
+		g.Combo("##audiosamplerate", audioSampleRateComboBoxLists[audioSampleRateComboBoxIdx], audioSampleRateComboBoxLists, &audioSampleRateComboBoxIdx).Size(90).OnChange(func() {
+			audioSampleRateToUse = audioSampleRateComboBoxLists[audioSampleRateComboBoxIdx]
+		}),
+	))
+
+	return widgets
+}
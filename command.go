@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// convertedPathFor returns destination path of given video, according to s
+func convertedPathFor(s conversionSettings, videoPath string) string {
+	dirname := filepath.Dir(videoPath)
+	filename := filepath.Base(videoPath)
+	fileext := filepath.Ext(videoPath)
+	filenameWithoutExt := strings.TrimSuffix(filename, fileext)
+
+	fileprefix := s.FilePrefix
+
+	if isImageOutputMode(s) {
+		return fmt.Sprintf("%s/%s%s%s", dirname, fileprefix, filenameWithoutExt, imageOutputExt(s))
+	}
+
+	if isStreamingOutputMode(s) {
+		return streamingOutputPath(s, fmt.Sprintf("%s/%s%s-%s", dirname, fileprefix, filenameWithoutExt, strings.ReplaceAll(s.StreamingFormat, " + ", "-")))
+	}
+
+	if "extract audio" == s.OutputMode {
+		return fmt.Sprintf("%s/%s%s%s", dirname, fileprefix, filenameWithoutExt, audioFormats[s.AudioFormat].ext)
+	}
+
+	switch s.Resolution {
+	case "original":
+	case "custom":
+		fileprefix += fmt.Sprintf("%dx%d-", s.CustomWidth, s.CustomHeight)
+	default:
+		fileprefix += fmt.Sprintf("%s-", s.Resolution)
+	}
+
+	switch s.ContainerFormat {
+	case "mp4":
+		fileext = ".mp4"
+	case "mkv":
+		fileext = ".mkv"
+	}
+
+	return fmt.Sprintf("%s/%s%s%s", dirname, fileprefix, filenameWithoutExt, fileext)
+}
+
+// ffmpegKwargs returns input and output kwargs converting videoPath into convertedPath.
+// Returned warnings describe conflicts between generated and advanced options.
+func ffmpegKwargs(s conversionSettings, videoPath, convertedPath string) (ffmpeg.KwArgs, ffmpeg.KwArgs, []string, error) {
+	inputKwargs := ffmpeg.KwArgs{}
+
+	var outputKwargs ffmpeg.KwArgs
+	var warnings []string
+	if isImageOutputMode(s) {
+		var err error
+		inputKwargs, outputKwargs, err = imageKwargs(s, videoPath)
+		if nil != err {
+			return nil, nil, nil, err
+		}
+	} else if isStreamingOutputMode(s) {
+		var err error
+		outputKwargs, err = streamingKwargs(s, videoPath, convertedPath)
+		if nil != err {
+			return nil, nil, nil, err
+		}
+	} else if "extract audio" == s.OutputMode {
+		outputKwargs = extractAudioKwargs(s, videoPath)
+		metadataKwargs(s, outputKwargs, videoPath, convertedPath)
+		// there is no video stream in output to map metadata into
+		delete(outputKwargs, "map_metadata:s:v")
+	} else {
+		outputKwargs = ffmpegOutputKwargs(s)
+		crfKwargs(s, outputKwargs, videoPath)
+
+		frameRateKwargs(s, outputKwargs, videoPath)
+		audioKwargs(s, outputKwargs, videoPath)
+		if err := filterKwargs(s, outputKwargs, videoPath); nil != err {
+			return nil, nil, nil, err
+		}
+		pixelFormatKwargs(s, outputKwargs, videoPath)
+		warnings = append(warnings, hdrKwargs(s, outputKwargs, videoPath)...)
+		warnings = append(warnings, webKwargs(s, outputKwargs, videoPath)...)
+		metadataKwargs(s, outputKwargs, videoPath, convertedPath)
+
+		if plan, _ := sourcePlan(s, videoPath); planRemux == plan {
+			remuxKwargs(outputKwargs)
+		}
+	}
+
+	if s.AdvancedMode {
+		advancedWarnings, err := mergeAdvancedKwargs(s, inputKwargs, outputKwargs)
+		if nil != err {
+			return nil, nil, nil, err
+		}
+		warnings = append(warnings, advancedWarnings...)
+	}
+
+	if _, ok := outputKwargs["filter_complex"]; ok {
+		if _, ok := outputKwargs["filter:v"]; ok {
+			return nil, nil, nil, fmt.Errorf("video filter cannot be applied on renditions of streaming package")
+		}
+	}
+
+	if err := streamCopyConflict(outputKwargs); nil != err {
+		return nil, nil, nil, err
+	}
+
+	return inputKwargs, outputKwargs, warnings, nil
+}
+
+// streamCopyConflict reports options which need re-encoding while the stream is copied as is,
+// ffmpeg refuses to filter a copied stream
+func streamCopyConflict(outputKwargs ffmpeg.KwArgs) error {
+	var conflicts []string
+
+	if "copy" == outputKwargs["c:v"] {
+		for _, key := range []string{"filter:v", "r", "pix_fmt"} {
+			if _, ok := outputKwargs[key]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("-%s needs re-encoding, choose a video codec other than original", key))
+			}
+		}
+	}
+
+	if "copy" == outputKwargs["c:a"] {
+		for _, key := range []string{"filter:a", "ac", "ar"} {
+			if _, ok := outputKwargs[key]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("-%s needs re-encoding, choose an audio codec other than original", key))
+			}
+		}
+	}
+
+	if 0 < len(conflicts) {
+		return errors.New(strings.Join(conflicts, "; "))
+	}
+
+	return nil
+}
+
+// ffmpegKwargsStatus returns warnings and error of options for first video in list, to show on GUI
+func ffmpegKwargsStatus(s conversionSettings) ([]string, error) {
+	videoPath := ""
+	if 0 < len(listOfVideos) {
+		videoPath = listOfVideos[0]
+	}
+
+	_, _, warnings, err := ffmpegKwargs(s, videoPath, convertedPathFor(s, videoPath))
+	return warnings, err
+}
+
+// ffmpegStream builds ffmpeg stream converting videoPath into convertedPath
+func ffmpegStream(s conversionSettings, videoPath, convertedPath string) (*ffmpeg.Stream, error) {
+	inputKwargs, outputKwargs, _, err := ffmpegKwargs(s, videoPath, convertedPath)
+	if nil != err {
+		return nil, err
+	}
+
+	return ffmpeg.Input(videoPath, inputKwargs).Output(convertedPath, outputKwargs).OverWriteOutput().WithErrorOutput(&convertingFFmpegOutput), nil
+}
+
+// compileFfmpegCmd builds ffmpeg command converting videoPath into convertedPath, without running it
+func compileFfmpegCmd(s conversionSettings, videoPath, convertedPath string) (*exec.Cmd, error) {
+	stream, err := ffmpegStream(s, videoPath, convertedPath)
+	if nil != err {
+		return nil, err
+	}
+
+	return stream.Compile(), nil
+}
+
+// ffmpegArgs returns full argument list (including program name) converting videoPath into convertedPath.
+// Unlike compileFfmpegCmd, it does not log, so it is cheap to call on every frame.
+func ffmpegArgs(s conversionSettings, videoPath, convertedPath string) ([]string, error) {
+	stream, err := ffmpegStream(s, videoPath, convertedPath)
+	if nil != err {
+		return nil, err
+	}
+
+	return append([]string{"ffmpeg"}, stream.GetArgs()...), nil
+}
+
+// ffmpegCommandPreview returns command lines for every video in list, one per line
+func ffmpegCommandPreview(s conversionSettings) string {
+	var lines []string
+
+	for _, videoPath := range listOfVideos {
+		args, err := ffmpegArgs(s, videoPath, convertedPathFor(s, videoPath))
+		if nil != err {
+			return err.Error()
+		}
+		lines = append(lines, commandLineString(args))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// parseCommandLine reads cli flags into settings, returns whether dry run is requested and the rest of arguments.
+// Unknown flags (e.g. -psn_* given by macOS Finder) are ignored so that GUI still starts.
+func parseCommandLine(args []string) (bool, []string) {
+	var dryRun bool
+	settings := currentSettings()
+
+	flagSet := flag.NewFlagSet("video-converter", flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flagSet.BoolVar(&dryRun, "dry-run", false, "print ffmpeg commands for given files without executing them")
+	flagSet.BoolVar(&serveAPI, "serve", false, "serve HTTP API alongside GUI")
+	flagSet.BoolVar(&headless, "headless", false, "serve HTTP API without GUI")
+	flagSet.StringVar(&apiListenAddr, "listen", apiListenAddr, "address HTTP API listens on")
+	flagSet.StringVar(&apiToken, "token", os.Getenv("VIDEO_CONVERTER_TOKEN"), "token required by HTTP API, as bearer token or token parameter")
+	flagSet.BoolVar(&saveToken, "save-token", false, "remember given token in encrypted settings store")
+	flagSet.BoolVar(&resetSettings, "reset-settings", false, "move unreadable settings store aside and start with empty one")
+	flagSet.StringVar(&settings.Resolution, "resolution", settings.Resolution, strings.Join(resComboBoxLists, ", "))
+	flagSet.StringVar(&settings.AudioCodec, "audio-codec", settings.AudioCodec, strings.Join(audioCodecComboBoxLists, ", "))
+	flagSet.StringVar(&settings.VideoCodec, "video-codec", settings.VideoCodec, strings.Join(videoCodecComboBoxLists, ", "))
+	flagSet.StringVar(&settings.ContainerFormat, "container", settings.ContainerFormat, strings.Join(containerFormatComboBoxLists, ", "))
+	flagSet.StringVar(&settings.FilePrefix, "prefix", settings.FilePrefix, "prefix of converted file name")
+	flagSet.StringVar(&settings.OutputMode, "mode", settings.OutputMode, strings.Join(outputModeComboBoxLists, ", "))
+	flagSet.StringVar(&settings.AudioFormat, "audio-format", settings.AudioFormat, strings.Join(audioFormatComboBoxLists, ", "))
+
+	if err := flagSet.Parse(args); nil != err {
+		return false, nil
+	}
+
+	applySettings(settings)
+
+	if headless {
+		serveAPI = true
+	}
+
+	return dryRun, flagSet.Args()
+}
+
+// printDryRun prints ffmpeg commands for given files, skipping directories and files not found
+func printDryRun(s conversionSettings, w io.Writer, filenames []string) {
+	for _, filename := range filenames {
+		filestat, err := os.Stat(filename)
+		if nil != err || filestat.IsDir() {
+			fmt.Fprintf(w, "# skipped %s\n", filename)
+			continue
+		}
+
+		// probing is best effort here, options depending on source are left out without it
+		if ffprobeOutput, err := detectWithFfprobe(filename); nil == err {
+			setVideoProbe(filename, ffprobeOutput)
+		}
+
+		if plan, reason := sourcePlan(s, filename); planSkip == plan {
+			fmt.Fprintf(w, "# skipped %s: %s\n", filename, reason)
+			continue
+		}
+
+		args, err := ffmpegArgs(s, filename, convertedPathFor(s, filename))
+		if nil != err {
+			fmt.Fprintf(w, "# %s: %s\n", filename, err)
+			continue
+		}
+		fmt.Fprintln(w, commandLineString(args))
+	}
+}
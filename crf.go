@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var rateControlComboBoxLists = []string{
+	"codec default",
+	"target quality",
+}
+var rateControlComboBoxIdx int32 = 0
+var rateControlToUse = "codec default"
+
+var targetQualityMetricComboBoxIdx int32 = 0
+var targetQualityMetricToUse = "VMAF"
+var targetQualityScore float32 = 93
+var crfSearchSamples int32 = 3
+
+// crfSampleDuration is length of each sample encoded while searching, in seconds
+const crfSampleDuration = 4
+
+// targetQualityDefaults is target score set when metric is chosen, good enough for most videos
+var targetQualityDefaults = map[string]float32{
+	"VMAF": 93,
+	"SSIM": 0.98,
+}
+
+// crfCandidates is CRF tried for each codec, from the best quality
+var crfCandidates = map[string][]int{
+	"H.264": {18, 22, 26, 30, 34},
+	"H.265": {20, 24, 28, 32, 36},
+}
+
+// searchedCrfs holds CRF found for each video, used by the full encode.
+// Worker writes it while GUI reads it for command preview, so it is accessed under mutex.
+var searchedCrfsMutex sync.Mutex
+var searchedCrfs = map[string]int{}
+
+func searchedCrfOf(videoPath string) (int, bool) {
+	searchedCrfsMutex.Lock()
+	defer searchedCrfsMutex.Unlock()
+
+	crf, ok := searchedCrfs[videoPath]
+	return crf, ok
+}
+
+func setSearchedCrf(videoPath string, crf int) {
+	searchedCrfsMutex.Lock()
+	searchedCrfs[videoPath] = crf
+	searchedCrfsMutex.Unlock()
+}
+
+func forgetSearchedCrf(videoPath string) {
+	searchedCrfsMutex.Lock()
+	delete(searchedCrfs, videoPath)
+	searchedCrfsMutex.Unlock()
+}
+
+// crfPoint is score measured on samples encoded with a CRF
+type crfPoint struct {
+	Crf   int     `json:"crf"`
+	Score float64 `json:"score"`
+}
+
+// crfSearch is result of searching CRF which meets target quality, kept on history
+type crfSearch struct {
+	Metric         string     `json:"metric"`
+	Target         float64    `json:"target"`
+	Samples        int        `json:"samples"`
+	SampleDuration float64    `json:"sample_duration"`
+	Points         []crfPoint `json:"points"`
+	Crf            int        `json:"crf"`
+	Note           string     `json:"note,omitempty"`
+}
+
+func (c crfSearch) String() string {
+	var points []string
+	for _, point := range c.Points {
+		points = append(points, fmt.Sprintf("%d=%.4g", point.Crf, point.Score))
+	}
+
+	ret := fmt.Sprintf("crf %d for %s %.4g (%s)", c.Crf, c.Metric, c.Target, strings.Join(points, ", "))
+	if "" != c.Note {
+		ret += ", " + c.Note
+	}
+
+	return ret
+}
+
+// isCrfSearchable reports whether CRF of videoPath is searched before converting it
+func isCrfSearchable(s conversionSettings, videoPath string) bool {
+	if "target quality" != s.RateControl || "convert video" != s.OutputMode {
+		return false
+	}
+	if _, ok := crfCandidates[s.VideoCodec]; !ok {
+		return false
+	}
+
+	plan, _ := sourcePlan(s, videoPath)
+	return planConvert == plan
+}
+
+// crfKwargs sets CRF found for videoPath, nothing when it is not searched yet (e.g. preview of command)
+func crfKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath string) {
+	if "target quality" != s.RateControl {
+		return
+	}
+
+	if crf, ok := searchedCrfOf(videoPath); ok {
+		args["crf"] = strconv.Itoa(crf)
+	}
+}
+
+// targetQualityMetricLists returns metrics usable as target which ffmpeg can compute
+func targetQualityMetricLists() []string {
+	var ret []string
+	for _, metric := range []string{"VMAF", "SSIM"} {
+		if hasFfmpegFilter(qualityMetricFilters[metric]) {
+			ret = append(ret, metric)
+		}
+	}
+
+	return ret
+}
+
+// samplePositions returns start of each sample, spread evenly so that neither start nor end of video is sampled
+func samplePositions(duration float64, samples int) []float64 {
+	if 1 > samples {
+		samples = 1
+	}
+	if crfSampleDuration*float64(samples) >= duration {
+		return []float64{0}
+	}
+
+	var ret []float64
+	for i := 0; i < samples; i++ {
+		center := duration * float64(i+1) / float64(samples+1)
+		ret = append(ret, math.Max(0, center-crfSampleDuration/2))
+	}
+
+	return ret
+}
+
+// interpolateCrf returns highest CRF whose score is expected to meet target, by linear interpolation
+// between measured points. Points outside of measured range are clamped to it, with a note.
+func interpolateCrf(points []crfPoint, target float64) (int, string) {
+	sorted := append([]crfPoint(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Crf < sorted[j].Crf })
+
+	if 0 == len(sorted) {
+		return 0, "nothing measured"
+	}
+	if target > sorted[0].Score {
+		return sorted[0].Crf, "target is not met even with the best quality tried"
+	}
+
+	for i := 1; i < len(sorted); i++ {
+		better, worse := sorted[i-1], sorted[i]
+		if target <= worse.Score {
+			continue
+		}
+		if better.Score == worse.Score {
+			return better.Crf, ""
+		}
+
+		crf := float64(better.Crf) + (better.Score-target)/(better.Score-worse.Score)*float64(worse.Crf-better.Crf)
+		return int(math.Floor(crf)), ""
+	}
+
+	return sorted[len(sorted)-1].Crf, "target is met even with the lowest quality tried"
+}
+
+// encodeCrfSample encodes video of a sample of videoPath with crf into samplePath, with every other option as the full encode
+func encodeCrfSample(s conversionSettings, videoPath, samplePath string, start float64, crf int) (string, string) {
+	inputKwargs, outputKwargs, _, err := ffmpegKwargs(s, videoPath, samplePath)
+	if nil != err {
+		return historyResultFailed, err.Error()
+	}
+
+	inputKwargs["ss"] = strconv.FormatFloat(start, 'f', 3, 64)
+	inputKwargs["t"] = strconv.Itoa(crfSampleDuration)
+
+	// only video is compared, and sample container (mkv) takes any video codec
+	for key := range outputKwargs {
+		if strings.HasPrefix(key, "map") || strings.HasPrefix(key, "metadata") {
+			delete(outputKwargs, key)
+		}
+	}
+	for _, key := range []string{"c:a", "b:a", "filter:a", "ac", "ar", "movflags"} {
+		delete(outputKwargs, key)
+	}
+	outputKwargs["an"] = ""
+	outputKwargs["sn"] = ""
+	outputKwargs["dn"] = ""
+	outputKwargs["crf"] = strconv.Itoa(crf)
+
+	ffmpegCmd := ffmpeg.Input(videoPath, inputKwargs).Output(samplePath, outputKwargs).OverWriteOutput().WithErrorOutput(&convertingFFmpegOutput).Compile()
+
+	return runFfmpegCmd(ffmpegCmd, samplePath)
+}
+
+// searchCrf encodes samples of videoPath with candidate CRFs from the best quality, measuring each of them,
+// until score falls below target. Then CRF meeting target is interpolated from measured points.
+func searchCrf(s conversionSettings, videoPath string) (crfSearch, string, string) {
+	metric := s.TargetQualityMetric
+	ret := crfSearch{
+		Metric:         metric,
+		Target:         float64(s.TargetQualityScore),
+		SampleDuration: crfSampleDuration,
+	}
+
+	if !hasFfmpegFilter(qualityMetricFilters[metric]) {
+		return ret, historyResultFailed, fmt.Sprintf("ffmpeg is not built with %s", qualityMetricFilters[metric])
+	}
+
+	tmpDir, err := os.MkdirTemp("", "video-converter-crf-")
+	if nil != err {
+		return ret, historyResultFailed, err.Error()
+	}
+	defer os.RemoveAll(tmpDir)
+
+	probe, _ := videoProbeOf(videoPath)
+	positions := samplePositions(probe.duration(), int(s.CrfSearchSamples))
+	ret.Samples = len(positions)
+
+	for _, crf := range crfCandidates[s.VideoCodec] {
+		total := 0.0
+
+		for i, start := range positions {
+			convertingHelperMsg = fmt.Sprintf("searching crf for %s %.4g, crf %d sample %d/%d:\n %s", metric, ret.Target, crf, i+1, len(positions), videoPath)
+
+			samplePath := filepath.Join(tmpDir, fmt.Sprintf("sample-%d-%d.mkv", crf, i))
+			if result, message := encodeCrfSample(s, videoPath, samplePath, start, crf); historyResultSuccess != result {
+				return ret, result, message
+			}
+
+			referenceArgs := []string{
+				"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+				"-t", strconv.Itoa(crfSampleDuration),
+				"-i", videoPath,
+			}
+			score, result, message := measureQuality(s, metric, videoPath, samplePath, referenceArgs)
+			if historyResultSuccess != result {
+				return ret, result, message
+			}
+			total += score
+		}
+
+		ret.Points = append(ret.Points, crfPoint{Crf: crf, Score: total / float64(len(positions))})
+		if ret.Target > total/float64(len(positions)) {
+			break
+		}
+	}
+
+	ret.Crf, ret.Note = interpolateCrf(ret.Points, ret.Target)
+
+	return ret, historyResultSuccess, ""
+}
+
+func rateControlLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Row(
+			g.Label("rate control"),
+			g.Dummy(10, 0),
+			g.Combo("##ratecontrol", rateControlComboBoxLists[rateControlComboBoxIdx], rateControlComboBoxLists, &rateControlComboBoxIdx).Size(130).OnChange(func() {
+				rateControlToUse = rateControlComboBoxLists[rateControlComboBoxIdx]
+			}),
+		),
+	}
+
+	if "target quality" != rateControlToUse {
+		return widgets
+	}
+
+	if _, ok := crfCandidates[videoCodecToUse]; !ok {
+		return append(widgets, g.Label("target quality needs H.264 or H.265 video codec"))
+	}
+
+	metrics := targetQualityMetricLists()
+	if 0 == len(metrics) {
+		return append(widgets, g.Label("target quality: ffmpeg has neither libvmaf nor ssim filter"))
+	}
+
+	targetQualityMetricComboBoxIdx = comboBoxIndexOf(metrics, targetQualityMetricToUse)
+	targetQualityMetricToUse = metrics[targetQualityMetricComboBoxIdx]
+
+	return append(widgets, g.Row(
+		g.Combo("##targetqualitymetric", metrics[targetQualityMetricComboBoxIdx], metrics, &targetQualityMetricComboBoxIdx).Size(80).OnChange(func() {
+			targetQualityMetricToUse = metrics[targetQualityMetricComboBoxIdx]
+			targetQualityScore = targetQualityDefaults[targetQualityMetricToUse]
+		}),
+		g.InputFloat(&targetQualityScore).Label("target").Format("%.3g").Size(60),
+		g.InputInt(&crfSearchSamples).Label("samples").Size(60),
+	))
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+// output has to fit with this much room to spare, as estimation is rough
+const diskSpaceMarginRatio = 1.2
+const diskSpaceReserve = 100 * 1024 * 1024
+
+// diskSpaceRecheckInterval is how often paused queue checks free space again by itself
+const diskSpaceRecheckInterval = 10 * time.Second
+
+// codecEfficiencies are rough bitrates of codecs relative to H.264 for the same quality
+var codecEfficiencies = map[string]float64{
+	"h264":       1,
+	"libx264":    1,
+	"hevc":       0.6,
+	"libx265":    0.6,
+	"vp9":        0.65,
+	"av1":        0.5,
+	"mpeg4":      1.5,
+	"mpeg2video": 2,
+	"mjpeg":      5,
+	"prores":     8,
+	"dnxhd":      8,
+}
+
+// audioEncoderBitrates are bitrates in kbps which audio encoders make when not given one
+var audioEncoderBitrates = map[string]float64{
+	"aac":        128,
+	"libopus":    96,
+	"libvorbis":  128,
+	"libmp3lame": 190,
+	"flac":       800,
+}
+
+var scaleSizeRegexp = regexp.MustCompile(`scale=(\d+):(\d+)`)
+
+var isQueuePaused bool
+var queuePausedMsg string
+var pausedJob *job
+var queueResumeChannel = make(chan bool, 1)
+
+// parseBitrate parses bitrate option of ffmpeg such as "128k" or "5M" into bits per second
+func parseBitrate(s string) float64 {
+	s = strings.TrimSpace(s)
+
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		multiplier = 1000
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1000 * 1000
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimRight(s, "kKM"), 64)
+	if nil != err {
+		return 0
+	}
+
+	return value * multiplier
+}
+
+// streamBitrates returns bitrates of first video and audio stream in bits per second. When streams do not tell
+// (e.g. mkv), video takes what is left of container bitrate.
+func (o ffprobeOutput) streamBitrates() (float64, float64) {
+	var video, audio float64
+	hasVideo := false
+
+	for _, stream := range o.Streams {
+		switch stream.CodecType {
+		case "video":
+			if !hasVideo && 0 == stream.Disposition.AttachedPic {
+				hasVideo = true
+				video, _ = strconv.ParseFloat(stream.BitRate, 64)
+			}
+		case "audio":
+			if 0 == audio {
+				audio, _ = strconv.ParseFloat(stream.BitRate, 64)
+			}
+		}
+	}
+
+	total, _ := strconv.ParseFloat(o.Format.BitRate, 64)
+	if 0 >= total {
+		if size, _ := strconv.ParseFloat(o.Format.Size, 64); 0 < size && 0 < o.duration() {
+			total = size * 8 / o.duration()
+		}
+	}
+
+	if hasVideo && 0 >= video {
+		video = total - audio
+	} else if !hasVideo && 0 >= audio {
+		audio = total
+	}
+	if 0 > video {
+		video = 0
+	}
+
+	return video, audio
+}
+
+// outputPixelRatio returns ratio of pixels in output frame to source frame of videoPath, 1 when unknown
+func outputPixelRatio(s conversionSettings, videoPath string) float64 {
+	probe, _ := videoProbeOf(videoPath)
+	srcWidth, srcHeight := probe.displaySize()
+	if 0 == srcWidth || 0 == srcHeight {
+		return 1
+	}
+
+	_, width, height := framingFilters(s, videoPath)
+	if matches := scaleSizeRegexp.FindAllStringSubmatch(scaleFilterFor(s, videoPath), -1); 0 < len(matches) {
+		width, _ = strconv.Atoi(matches[len(matches)-1][1])
+		height, _ = strconv.Atoi(matches[len(matches)-1][2])
+	}
+	if 0 >= width || 0 >= height {
+		return 1
+	}
+
+	return float64(width*height) / float64(srcWidth*srcHeight)
+}
+
+// estimateOutputSize returns rough size in bytes of output of videoPath, from source bitrate and duration
+// adjusted by target settings. Images are not estimated.
+func estimateOutputSize(s conversionSettings, videoPath string) (int64, bool) {
+	probe, _ := videoProbeOf(videoPath)
+	duration := probe.duration() / playbackSpeedFactor(s)
+	if isImageOutputMode(s) || 0 >= duration {
+		return 0, false
+	}
+
+	_, args, _, err := ffmpegKwargs(s, videoPath, convertedPathFor(s, videoPath))
+	if nil != err {
+		return 0, false
+	}
+
+	sourceVideo, sourceAudio := probe.streamBitrates()
+	if 0 >= sourceVideo+sourceAudio {
+		return 0, false
+	}
+
+	var video, explicitVideo float64
+	for key, value := range args {
+		if "b:v" == key || strings.HasPrefix(key, "b:v:") {
+			explicitVideo += parseBitrate(fmt.Sprint(value))
+		}
+	}
+	switch {
+	case "extract audio" == s.OutputMode:
+	case 0 < explicitVideo:
+		video = explicitVideo
+	case "copy" == args["c:v"]:
+		video = sourceVideo
+	default:
+		video = sourceVideo * outputPixelRatio(s, videoPath)
+
+		if efficiency, ok := codecEfficiencies[fmt.Sprint(args["c:v"])]; ok {
+			if sourceEfficiency, ok := codecEfficiencies[probe.videoCodecName()]; ok {
+				video *= efficiency / sourceEfficiency
+			}
+		}
+
+		_, sourceRate := probe.frameRates()
+		if rate := parseRational(fmt.Sprint(args["r"])); 0 < rate && 0 < sourceRate {
+			video *= rate / sourceRate
+		}
+	}
+
+	var audio float64
+	switch _, noAudio := args["an"]; {
+	case noAudio || 0 >= sourceAudio:
+	case nil != args["b:a"]:
+		audio = parseBitrate(fmt.Sprint(args["b:a"]))
+	case "copy" == args["c:a"]:
+		audio = sourceAudio
+	case "pcm_s16le" == args["c:a"]:
+		audio = 48000 * 2 * 16
+	default:
+		if kbps, ok := audioEncoderBitrates[fmt.Sprint(args["c:a"])]; ok {
+			audio = kbps * 1000
+		} else {
+			audio = sourceAudio
+		}
+	}
+
+	// container overhead is a few percent
+	return int64((video + audio) * duration / 8 * 1.02), true
+}
+
+// existingDir returns path itself or its closest parent which exists, output directory may not be made yet
+func existingDir(path string) string {
+	dir := path
+	for {
+		if info, err := os.Stat(dir); nil == err && info.IsDir() {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// diskSpaceProblem returns why output of videoPath may not fit on its volume, empty if it fits or is not known
+func diskSpaceProblem(s conversionSettings, videoPath string) string {
+	estimate, ok := estimateOutputSize(s, videoPath)
+	if !ok {
+		return ""
+	}
+
+	dir := existingDir(filepath.Dir(convertedPathFor(s, videoPath)))
+	free, err := freeDiskSpace(dir)
+	if nil != err {
+		return ""
+	}
+
+	if required := int64(float64(estimate)*diskSpaceMarginRatio) + diskSpaceReserve; free < required {
+		return fmt.Sprintf("%s needs about %s but only %s is free on %s", filepath.Base(videoPath), formatSize(required), formatSize(free), dir)
+	}
+
+	return ""
+}
+
+// waitForDiskSpace blocks queue until output of queued job j fits on disk, user forces it or j is cancelled
+func waitForDiskSpace(j *job) {
+	defer func() {
+		if isQueuePaused {
+			jobsMutex.Lock()
+			if jobStatusQueued == j.Status {
+				j.Message = ""
+			}
+			snapshot := *j
+			jobsMutex.Unlock()
+			publishJob(snapshot)
+		}
+
+		isQueuePaused = false
+		queuePausedMsg = ""
+		pausedJob = nil
+	}()
+
+	for {
+		snapshot := jobSnapshot(j)
+		if jobStatusQueued != snapshot.Status {
+			return
+		}
+
+		setVideoProbe(snapshot.InputPath, snapshot.probe)
+		problem := diskSpaceProblem(snapshot.Settings, snapshot.InputPath)
+
+		if "" == problem {
+			return
+		}
+
+		queuePausedMsg = fmt.Sprintf("queue paused, not enough disk space: %s", problem)
+		if !isQueuePaused {
+			isQueuePaused = true
+			pausedJob = j
+
+			// drop a click left over from an earlier pause
+			select {
+			case <-queueResumeChannel:
+			default:
+			}
+
+			jobsMutex.Lock()
+			j.Message = queuePausedMsg
+			snapshot = *j
+			jobsMutex.Unlock()
+			publishJob(snapshot)
+		}
+		g.Update()
+
+		select {
+		case force := <-queueResumeChannel:
+			if force {
+				return
+			}
+		case <-time.After(diskSpaceRecheckInterval):
+		}
+	}
+}
+
+// resumeQueue wakes paused queue up, checking disk space again unless forced
+func resumeQueue(force bool) {
+	select {
+	case queueResumeChannel <- force:
+	default:
+	}
+}
+
+// estimatedBatchSize returns estimated total size of outputs of every video in list, and how many are not estimated
+func estimatedBatchSize(s conversionSettings) (int64, int) {
+	var total int64
+	unknown := 0
+
+	for _, videoPath := range listOfVideos {
+		if size, ok := estimateOutputSize(s, videoPath); ok {
+			total += size
+		} else {
+			unknown++
+		}
+	}
+
+	return total, unknown
+}
+
+// estimatedSizeLabel describes estimated output size of list against free space of its first output volume
+func estimatedSizeLabel(s conversionSettings) string {
+	total, unknown := estimatedBatchSize(s)
+	if unknown == len(listOfVideos) {
+		return ""
+	}
+
+	label := fmt.Sprintf("estimated output: ~%s", formatSize(total))
+	if 0 < unknown {
+		label += fmt.Sprintf(" (%d not estimated)", unknown)
+	}
+
+	dir := existingDir(filepath.Dir(convertedPathFor(s, listOfVideos[0])))
+	if free, err := freeDiskSpace(dir); nil == err {
+		label += fmt.Sprintf(", %s free", formatSize(free))
+		if free < int64(float64(total)*diskSpaceMarginRatio)+diskSpaceReserve {
+			label += "\nwarning: outputs may not fit on disk, queue pauses before a job which does not fit"
+		}
+	}
+
+	return label
+}
+
+func diskSpaceLayouts() []g.Widget {
+	if !isQueuePaused {
+		return nil
+	}
+
+	return []g.Widget{
+		g.Label(queuePausedMsg).Wrapped(true),
+		g.Row(
+			g.Button("Check again").OnClick(func() {
+				resumeQueue(false)
+			}),
+			g.Button("Start anyway").OnClick(func() {
+				resumeQueue(true)
+			}),
+			g.Button("Cancel job").OnClick(cancelPausedJob),
+		),
+	}
+}
+
+// cancelPausedJob cancels the queued job waiting for disk space
+func cancelPausedJob() {
+	if j := pausedJob; nil != j {
+		cancelJob(j)
+		resumeQueue(false)
+	}
+}
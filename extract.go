@@ -0,0 +1,103 @@
+package main
+
+import (
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var outputModeComboBoxLists = []string{
+	"convert video",
+	"extract audio",
+	"thumbnail",
+	"frames",
+	"contact sheet",
+	"gif",
+	"webp",
+	"streaming",
+}
+var outputModeComboBoxIdx int32 = 0
+var outputModeToUse = "convert video"
+
+var audioFormatComboBoxLists = []string{
+	"m4a",
+	"mp3",
+	"opus",
+	"flac",
+	"wav",
+}
+var audioFormatComboBoxIdx int32 = 0
+var audioFormatToUse = "m4a"
+
+// audioFormat describes how to encode audio for an audio-only container
+type audioFormat struct {
+	ext string
+	// codecName is codec name ffprobe reports, for which stream copy is possible
+	codecName string
+	kwargs    ffmpeg.KwArgs
+}
+
+var audioFormats = map[string]audioFormat{
+	"m4a":  {".m4a", "aac", ffmpeg.KwArgs{"c:a": "aac", "b:a": "192k"}},
+	"mp3":  {".mp3", "mp3", ffmpeg.KwArgs{"c:a": "libmp3lame", "q:a": "2", "id3v2_version": "3"}},
+	"opus": {".opus", "opus", ffmpeg.KwArgs{"c:a": "libopus", "b:a": "96k"}},
+	"flac": {".flac", "flac", ffmpeg.KwArgs{"c:a": "flac"}},
+	"wav":  {".wav", "pcm_s16le", ffmpeg.KwArgs{"c:a": "pcm_s16le"}},
+}
+
+// audioCodecName returns codec name of first audio stream, empty if there is no audio
+func (o ffprobeOutput) audioCodecName() string {
+	for _, stream := range o.Streams {
+		if "audio" == stream.CodecType {
+			return stream.CodecName
+		}
+	}
+
+	return ""
+}
+
+// extractAudioKwargs returns output kwargs dropping video, audio is copied when source codec already matches
+func extractAudioKwargs(s conversionSettings, videoPath string) ffmpeg.KwArgs {
+	format := audioFormats[s.AudioFormat]
+
+	args := ffmpeg.KwArgs{
+		"vn": "",
+		"sn": "",
+		"dn": "",
+	}
+	for key, value := range format.kwargs {
+		args[key] = value
+	}
+
+	audioKwargs(s, args, videoPath)
+
+	_, hasFilter := args["filter:a"]
+	_, hasChannels := args["ac"]
+	_, hasSampleRate := args["ar"]
+	probe, _ := videoProbeOf(videoPath)
+	if !hasFilter && !hasChannels && !hasSampleRate && format.codecName == probe.audioCodecName() {
+		for key := range format.kwargs {
+			delete(args, key)
+		}
+		args["c:a"] = "copy"
+		// mp3 muxer option is not about encoding, keep tags readable by old players
+		if "mp3" == s.AudioFormat {
+			args["id3v2_version"] = "3"
+		}
+	}
+
+	return args
+}
+
+func extractAudioLayouts() []g.Widget {
+	return []g.Widget{
+		g.Row(
+			g.Label("audio format"),
+			g.Dummy(10, 0),
+			g.Combo("##audioformat", audioFormatComboBoxLists[audioFormatComboBoxIdx], audioFormatComboBoxLists, &audioFormatComboBoxIdx).OnChange(func() {
+				audioFormatToUse = audioFormatComboBoxLists[audioFormatComboBoxIdx]
+			}),
+		),
+		g.Label("video is dropped, audio is copied as is when source codec already matches").Wrapped(true),
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var deinterlaceComboBoxLists = []string{
+	"auto",
+	"always",
+	"off",
+}
+var deinterlaceComboBoxIdx int32 = 0
+var deinterlaceToUse = "auto"
+
+var deinterlaceFilterComboBoxLists = []string{
+	"bwdif",
+	"yadif",
+}
+var deinterlaceFilterComboBoxIdx int32 = 0
+var deinterlaceFilterToUse = "bwdif"
+
+var denoiseComboBoxLists = []string{
+	"none",
+	"hqdn3d",
+	"nlmeans",
+}
+var denoiseComboBoxIdx int32 = 0
+var denoiseToUse = "none"
+
+var denoiseStrengthComboBoxLists = []string{
+	"light",
+	"medium",
+	"strong",
+}
+var denoiseStrengthComboBoxIdx int32 = 1
+var denoiseStrengthToUse = "medium"
+
+var cropModeComboBoxLists = []string{
+	"none",
+	"manual",
+	"auto",
+}
+var cropModeComboBoxIdx int32 = 0
+var cropModeToUse = "none"
+
+var rotateComboBoxLists = []string{
+	"none",
+	"90° clockwise",
+	"90° counterclockwise",
+	"180°",
+}
+var rotateComboBoxIdx int32 = 0
+var rotateToUse = "none"
+
+var sharpen bool
+var sharpenAmount float32 = 1
+var cropTop, cropBottom, cropLeft, cropRight int32
+var flipHorizontal bool
+var flipVertical bool
+var playbackSpeed float32 = 1
+
+// denoiseParams maps denoise filter and strength to its options
+var denoiseParams = map[string]map[string]string{
+	"hqdn3d": {
+		"light":  "2:1.5:3:2.25",
+		"medium": "4:3:6:4.5",
+		"strong": "8:6:12:9",
+	},
+	"nlmeans": {
+		"light":  "s=1",
+		"medium": "s=3",
+		"strong": "s=6",
+	},
+}
+
+var cropdetectRegexp = regexp.MustCompile(`crop=(\d+):(\d+):(\d+):(\d+)`)
+
+// detectedCrops holds crop area detected for each video, used by conversion.
+// Worker writes it while GUI reads it for command preview, so it is accessed under mutex.
+var detectedCropsMutex sync.Mutex
+var detectedCrops = map[string]cropArea{}
+
+// cropArea is part of frames kept by crop filter
+type cropArea struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+}
+
+func detectedCropOf(videoPath string) (cropArea, bool) {
+	detectedCropsMutex.Lock()
+	defer detectedCropsMutex.Unlock()
+
+	area, ok := detectedCrops[videoPath]
+	return area, ok
+}
+
+func setDetectedCrop(videoPath string, area cropArea) {
+	detectedCropsMutex.Lock()
+	detectedCrops[videoPath] = area
+	detectedCropsMutex.Unlock()
+}
+
+func forgetDetectedCrop(videoPath string) {
+	detectedCropsMutex.Lock()
+	delete(detectedCrops, videoPath)
+	detectedCropsMutex.Unlock()
+}
+
+func (c cropArea) filter() string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", c.Width, c.Height, c.X, c.Y)
+}
+
+// isInterlaced reports whether first video stream is interlaced according to its field order
+func (o ffprobeOutput) isInterlaced() bool {
+	idx, ok := o.videoStream()
+	if !ok {
+		return false
+	}
+
+	switch o.Streams[idx].FieldOrder {
+	case "tt", "bb", "tb", "bt":
+		return true
+	}
+
+	return false
+}
+
+// isVideoFiltering reports whether filters of s apply, only converting video is filtered
+func isVideoFiltering(s conversionSettings) bool {
+	return "convert video" == s.OutputMode
+}
+
+// isAutoCrop reports whether crop area is detected before converting
+func isAutoCrop(s conversionSettings) bool {
+	return isVideoFiltering(s) && "auto" == s.CropMode
+}
+
+// playbackSpeedFactor returns speed factor of output, 1 when speed does not change
+func playbackSpeedFactor(s conversionSettings) float64 {
+	if !isVideoFiltering(s) || 0 >= s.PlaybackSpeed {
+		return 1
+	}
+
+	return float64(s.PlaybackSpeed)
+}
+
+// framingFilters returns filters deciding which part of frames is shown in which orientation and colors
+// (deinterlace, tone mapping, crop, rotate, flip), with display size of frames after them, 0 when it is unknown.
+// They come before any other filter so that scaling sees the final frame, and quality analysis
+// applies them on source as well.
+func framingFilters(s conversionSettings, videoPath string) ([]string, int, int) {
+	probe, _ := videoProbeOf(videoPath)
+	width, height := probe.displaySize()
+
+	if !isVideoFiltering(s) {
+		return nil, width, height
+	}
+
+	var filters []string
+
+	// copied video cannot be filtered, so it is deinterlaced automatically only when re-encoded
+	if "always" == s.Deinterlace || ("auto" == s.Deinterlace && "original" != s.VideoCodec && probe.isInterlaced()) {
+		// one frame for each frame, not for each field, so that frame rate stays
+		filters = append(filters, fmt.Sprintf("%s=mode=send_frame", s.DeinterlaceFilter))
+	}
+
+	if isToneMapping(s, videoPath) {
+		filters = append(filters, tonemapFilter(s))
+	}
+
+	switch s.CropMode {
+	case "manual":
+		if 0 != s.CropTop || 0 != s.CropBottom || 0 != s.CropLeft || 0 != s.CropRight {
+			filters = append(filters, fmt.Sprintf("crop=in_w-%d:in_h-%d:%d:%d", s.CropLeft+s.CropRight, s.CropTop+s.CropBottom, s.CropLeft, s.CropTop))
+			if 0 < width && 0 < height {
+				width -= int(s.CropLeft + s.CropRight)
+				height -= int(s.CropTop + s.CropBottom)
+			}
+		}
+	case "auto":
+		// not detected yet (e.g. preview of command), left uncropped
+		if area, ok := detectedCropOf(videoPath); ok {
+			filters = append(filters, area.filter())
+			width, height = area.Width, area.Height
+		}
+	}
+
+	switch s.Rotate {
+	case "90° clockwise":
+		filters = append(filters, "transpose=clock")
+		width, height = height, width
+	case "90° counterclockwise":
+		filters = append(filters, "transpose=cclock")
+		width, height = height, width
+	case "180°":
+		filters = append(filters, "hflip", "vflip")
+	}
+
+	if s.FlipHorizontal {
+		filters = append(filters, "hflip")
+	}
+	if s.FlipVertical {
+		filters = append(filters, "vflip")
+	}
+
+	return filters, width, height
+}
+
+// speedFilter returns video filter changing playback speed, empty when speed does not change
+func speedFilter(s conversionSettings) string {
+	speed := playbackSpeedFactor(s)
+	if 1 == speed {
+		return ""
+	}
+
+	return fmt.Sprintf("setpts=PTS/%s", strconv.FormatFloat(speed, 'f', -1, 64))
+}
+
+// atempoFilter returns audio filter chain changing tempo as video speed, without changing pitch.
+// Each atempo is kept within 0.5 to 2, which is what older ffmpeg accepts.
+func atempoFilter(s conversionSettings) string {
+	speed := playbackSpeedFactor(s)
+	if 1 == speed {
+		return ""
+	}
+
+	var filters []string
+	for 2 < speed {
+		filters = append(filters, "atempo=2")
+		speed /= 2
+	}
+	for 0.5 > speed {
+		filters = append(filters, "atempo=0.5")
+		speed /= 0.5
+	}
+	filters = append(filters, fmt.Sprintf("atempo=%s", strconv.FormatFloat(speed, 'f', -1, 64)))
+
+	return strings.Join(filters, ",")
+}
+
+// videoFilterChain returns whole video filter chain of videoPath in one graph:
+// framing, denoise, scale, sharpen, then speed
+func videoFilterChain(s conversionSettings, videoPath string) string {
+	filters, _, _ := framingFilters(s, videoPath)
+
+	if isVideoFiltering(s) && "none" != s.Denoise {
+		filters = append(filters, fmt.Sprintf("%s=%s", s.Denoise, denoiseParams[s.Denoise][s.DenoiseStrength]))
+	}
+
+	if scale := scaleFilterFor(s, videoPath); "" != scale {
+		filters = append(filters, scale)
+	}
+
+	if isVideoFiltering(s) && s.Sharpen && 0 != s.SharpenAmount {
+		filters = append(filters, fmt.Sprintf("unsharp=5:5:%s:5:5:0", strconv.FormatFloat(float64(s.SharpenAmount), 'f', -1, 32)))
+	}
+
+	if speed := speedFilter(s); "" != speed {
+		filters = append(filters, speed)
+	}
+
+	return strings.Join(filters, ",")
+}
+
+// hasVideoFilters reports whether any filter other than scaling applies on videoPath
+func hasVideoFilters(s conversionSettings, videoPath string) bool {
+	if !isVideoFiltering(s) {
+		return false
+	}
+
+	filters, _, _ := framingFilters(s, videoPath)
+	return 0 < len(filters) || "none" != s.Denoise || (s.Sharpen && 0 != s.SharpenAmount) || "" != speedFilter(s) || isOverlaying(s)
+}
+
+// filterKwargs sets video filter chain and matching audio tempo for videoPath
+func filterKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath string) error {
+	if isVideoFiltering(s) && 0 >= s.PlaybackSpeed {
+		return fmt.Errorf("playback speed must be positive")
+	}
+	if isVideoFiltering(s) {
+		if err := customSizeError(s); nil != err {
+			return err
+		}
+	}
+
+	chain, err := withOverlays(s, videoFilterChain(s, videoPath), videoPath)
+	if nil != err {
+		return err
+	}
+	if "" != chain {
+		args["filter:v"] = chain
+	}
+	appendFilterChain(args, "filter:a", atempoFilter(s))
+
+	return nil
+}
+
+// detectCrop finds area of videoPath without black borders, looking at key frames only so that it is fast.
+// Area grows over the whole video, so that nothing shown in any frame is cropped.
+func detectCrop(videoPath string) (cropArea, string, string) {
+	var area cropArea
+	var stderr bytes.Buffer
+
+	ffmpegCmd := exec.Command("ffmpeg",
+		"-hide_banner", "-nostats",
+		"-skip_frame", "nokey",
+		"-i", videoPath,
+		"-map", "0:v:0",
+		"-vf", "cropdetect=limit=24:round=2:reset=0",
+		"-f", "null", "-",
+	)
+	ffmpegCmd.Stderr = io.MultiWriter(&stderr, &convertingFFmpegOutput)
+
+	result, message := runFfmpegCmd(ffmpegCmd, videoPath)
+	if historyResultSuccess != result {
+		return area, result, message
+	}
+
+	matches := cropdetectRegexp.FindAllStringSubmatch(stderr.String(), -1)
+	if 0 == len(matches) {
+		return area, historyResultFailed, "cropdetect found nothing"
+	}
+
+	last := matches[len(matches)-1]
+	area.Width, _ = strconv.Atoi(last[1])
+	area.Height, _ = strconv.Atoi(last[2])
+	area.X, _ = strconv.Atoi(last[3])
+	area.Y, _ = strconv.Atoi(last[4])
+
+	if 0 >= area.Width || 0 >= area.Height {
+		return area, historyResultFailed, fmt.Sprintf("cropdetect found invalid area %s", last[0])
+	}
+
+	return area, historyResultSuccess, ""
+}
+
+func filtersLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Row(
+			g.Label("deinterlace"),
+			g.Combo("##deinterlace", deinterlaceComboBoxLists[deinterlaceComboBoxIdx], deinterlaceComboBoxLists, &deinterlaceComboBoxIdx).Size(80).OnChange(func() {
+				deinterlaceToUse = deinterlaceComboBoxLists[deinterlaceComboBoxIdx]
+			}),
+			g.Combo("##deinterlacefilter", deinterlaceFilterComboBoxLists[deinterlaceFilterComboBoxIdx], deinterlaceFilterComboBoxLists, &deinterlaceFilterComboBoxIdx).Size(80).OnChange(func() {
+				deinterlaceFilterToUse = deinterlaceFilterComboBoxLists[deinterlaceFilterComboBoxIdx]
+			}),
+		),
+		g.Row(
+			g.Label("denoise"),
+			g.Combo("##denoise", denoiseComboBoxLists[denoiseComboBoxIdx], denoiseComboBoxLists, &denoiseComboBoxIdx).Size(80).OnChange(func() {
+				denoiseToUse = denoiseComboBoxLists[denoiseComboBoxIdx]
+			}),
+			g.Combo("##denoisestrength", denoiseStrengthComboBoxLists[denoiseStrengthComboBoxIdx], denoiseStrengthComboBoxLists, &denoiseStrengthComboBoxIdx).Size(80).OnChange(func() {
+				denoiseStrengthToUse = denoiseStrengthComboBoxLists[denoiseStrengthComboBoxIdx]
+			}),
+		),
+		g.Row(
+			g.Checkbox("sharpen", &sharpen),
+			g.InputFloat(&sharpenAmount).Label("amount").Format("%.1f").Size(60),
+		),
+		g.Row(
+			g.Label("crop"),
+			g.Combo("##cropmode", cropModeComboBoxLists[cropModeComboBoxIdx], cropModeComboBoxLists, &cropModeComboBoxIdx).Size(80).OnChange(func() {
+				cropModeToUse = cropModeComboBoxLists[cropModeComboBoxIdx]
+			}),
+		),
+	}
+
+	if "manual" == cropModeToUse {
+		widgets = append(widgets, g.Row(
+			g.InputInt(&cropTop).Label("top").Size(60),
+			g.InputInt(&cropBottom).Label("bottom").Size(60),
+			g.InputInt(&cropLeft).Label("left").Size(60),
+			g.InputInt(&cropRight).Label("right").Size(60),
+		))
+	}
+
+	widgets = append(widgets, []g.Widget{
+		g.Row(
+			g.Label("rotate"),
+			g.Combo("##rotate", rotateComboBoxLists[rotateComboBoxIdx], rotateComboBoxLists, &rotateComboBoxIdx).Size(160).OnChange(func() {
+				rotateToUse = rotateComboBoxLists[rotateComboBoxIdx]
+			}),
+			g.Checkbox("flip horizontally", &flipHorizontal),
+			g.Checkbox("flip vertically", &flipVertical),
+		),
+		g.InputFloat(&playbackSpeed).Label("playback speed").Format("%.2f").Size(60),
+	}...)
+
+	return []g.Widget{
+		g.TreeNode("filters").Layout(widgets...),
+	}
+}
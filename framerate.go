@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var frameRateComboBoxLists = []string{
+	"original",
+	"24",
+	"25",
+	"30",
+	"60",
+	"custom",
+}
+var frameRateComboBoxIdx int32 = 0
+var frameRateToUse = "original"
+
+var customFrameRate float32 = 29.97
+var forceConstantFrameRate = true
+var normalizeVariableFrameRate bool
+
+// parseRational parses ffprobe rational such as "30000/1001", returns 0 on malformed or zero denominator
+func parseRational(s string) float64 {
+	parts := strings.SplitN(s, "/", 2)
+
+	num, err := strconv.ParseFloat(parts[0], 64)
+	if nil != err {
+		return 0
+	}
+
+	if 1 == len(parts) {
+		return num
+	}
+
+	den, err := strconv.ParseFloat(parts[1], 64)
+	if nil != err || 0 == den {
+		return 0
+	}
+
+	return num / den
+}
+
+// frameRates returns real base and average frame rate of first video stream
+func (o ffprobeOutput) frameRates() (float64, float64) {
+	idx, ok := o.videoStream()
+	if !ok {
+		return 0, 0
+	}
+
+	return parseRational(o.Streams[idx].RFrameRate), parseRational(o.Streams[idx].AvgFrameRate)
+}
+
+// isVariableFrameRate reports whether first video stream looks like variable frame rate.
+// For constant frame rate, real base frame rate and average frame rate are (almost) equal.
+func (o ffprobeOutput) isVariableFrameRate() bool {
+	rFrameRate, avgFrameRate := o.frameRates()
+	if 0 == rFrameRate || 0 == avgFrameRate {
+		return false
+	}
+
+	return 0.01 < math.Abs(rFrameRate-avgFrameRate)/avgFrameRate
+}
+
+// frameRateKwargs adds frame rate options for videoPath, according to s
+func frameRateKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath string) {
+	rate := ""
+
+	switch s.FrameRate {
+	case "original":
+		// normalizing is opt-in, and copied video keeps its timestamps as they are
+		probe, _ := videoProbeOf(videoPath)
+		if !s.NormalizeVariableFrameRate || "original" == s.VideoCodec || !probe.isVariableFrameRate() {
+			return
+		}
+
+		// normalize to average frame rate, which is what player shows as frame rate of source
+		_, avgFrameRate := probe.frameRates()
+		rate = strconv.FormatFloat(math.Round(avgFrameRate*1000)/1000, 'f', -1, 64)
+		args["vsync"] = "cfr"
+	case "custom":
+		rate = strconv.FormatFloat(float64(s.CustomFrameRate), 'f', -1, 32)
+	default:
+		rate = s.FrameRate
+	}
+
+	args["r"] = rate
+	if s.ForceConstantFrameRate {
+		args["vsync"] = "cfr"
+	}
+}
+
+// variableFrameRateVideos returns videos in list which look like variable frame rate
+func variableFrameRateVideos() []string {
+	var ret []string
+
+	for _, videoPath := range listOfVideos {
+		if probe, _ := videoProbeOf(videoPath); probe.isVariableFrameRate() {
+			ret = append(ret, videoPath)
+		}
+	}
+
+	return ret
+}
+
+func frameRateLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Row(
+			g.Label("frame rate"),
+			g.Dummy(10, 0),
+			g.Combo("##framerate", frameRateComboBoxLists[frameRateComboBoxIdx], frameRateComboBoxLists, &frameRateComboBoxIdx).Size(100).OnChange(func() {
+				frameRateToUse = frameRateComboBoxLists[frameRateComboBoxIdx]
+			}),
+		),
+	}
+
+	if "custom" == frameRateToUse {
+		widgets = append(widgets, g.InputFloat(&customFrameRate).Label("fps").Format("%.3f").Size(100))
+	}
+
+	if "original" != frameRateToUse {
+		widgets = append(widgets, g.Checkbox("force constant frame rate", &forceConstantFrameRate))
+	}
+
+	if vfrVideos := variableFrameRateVideos(); 0 < len(vfrVideos) {
+		widgets = append(widgets, g.Label(fmt.Sprintf("warning: %d file(s) have variable frame rate, which may cause audio drift in editing tools", len(vfrVideos))).Wrapped(true))
+
+		if "original" == frameRateToUse && "original" != videoCodecToUse {
+			widgets = append(widgets, g.Checkbox("normalize variable frame rate to constant", &normalizeVariableFrameRate))
+		}
+	}
+
+	return widgets
+}
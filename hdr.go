@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var hdrModeComboBoxLists = []string{
+	"tone map to SDR",
+	"preserve HDR",
+	"leave as is",
+}
+var hdrModeComboBoxIdx int32 = 0
+var hdrModeToUse = "tone map to SDR"
+
+var tonemapComboBoxLists = []string{
+	"hable",
+	"mobius",
+	"reinhard",
+}
+var tonemapComboBoxIdx int32 = 0
+var tonemapToUse = "hable"
+
+// hdrTransfers maps transfer characteristics of HDR to its name
+var hdrTransfers = map[string]string{
+	"smpte2084":    "PQ",
+	"arib-std-b67": "HLG",
+}
+
+// hdrFormat returns name of HDR transfer of first video stream, empty if it is SDR
+func (o ffprobeOutput) hdrFormat() string {
+	idx, ok := o.videoStream()
+	if !ok {
+		return ""
+	}
+
+	return hdrTransfers[o.Streams[idx].ColorTransfer]
+}
+
+// masteringDisplay returns mastering display and content light level of first video stream in x265 syntax,
+// empty if source has none
+func (o ffprobeOutput) masteringDisplay() (string, string) {
+	idx, ok := o.videoStream()
+	if !ok {
+		return "", ""
+	}
+
+	display, light := "", ""
+	for _, sideData := range o.Streams[idx].SideDataList {
+		switch sideData.SideDataType {
+		case "Mastering display metadata":
+			// x265 takes chromaticity in 0.00002 and luminance in 0.0001 cd/m2 units
+			chromaticity := func(s string) int { return int(parseRational(s)*50000 + 0.5) }
+			luminance := func(s string) int { return int(parseRational(s)*10000 + 0.5) }
+
+			display = fmt.Sprintf("G(%d,%d)B(%d,%d)R(%d,%d)WP(%d,%d)L(%d,%d)",
+				chromaticity(sideData.GreenX), chromaticity(sideData.GreenY),
+				chromaticity(sideData.BlueX), chromaticity(sideData.BlueY),
+				chromaticity(sideData.RedX), chromaticity(sideData.RedY),
+				chromaticity(sideData.WhitePointX), chromaticity(sideData.WhitePointY),
+				luminance(sideData.MaxLuminance), luminance(sideData.MinLuminance),
+			)
+		case "Content light level metadata":
+			light = fmt.Sprintf("%d,%d", sideData.MaxContent, sideData.MaxAverage)
+		}
+	}
+
+	return display, light
+}
+
+// isToneMapping reports whether HDR of videoPath is tone mapped to SDR. Copied video is never filtered,
+// so it keeps HDR whatever the mode is.
+func isToneMapping(s conversionSettings, videoPath string) bool {
+	probe, _ := videoProbeOf(videoPath)
+	if !isVideoFiltering(s) || "original" == s.VideoCodec || "" == probe.hdrFormat() {
+		return false
+	}
+
+	// only H.264 cannot carry HDR
+	return "tone map to SDR" == s.HdrMode || ("preserve HDR" == s.HdrMode && "H.264" == s.VideoCodec)
+}
+
+// tonemapFilter returns filter chain converting HDR into SDR BT.709, in linear light so that highlights are kept
+func tonemapFilter(s conversionSettings) string {
+	return fmt.Sprintf("zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=%s:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p", s.Tonemap)
+}
+
+// hdrKwargs sets color metadata of output for HDR source of videoPath: BT.709 when tone mapped,
+// or same as source with x265 HDR signaling when preserved. Returned warnings describe what cannot be done.
+func hdrKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath string) []string {
+	probe, _ := videoProbeOf(videoPath)
+	if !isVideoFiltering(s) || "" == probe.hdrFormat() || "leave as is" == s.HdrMode {
+		return nil
+	}
+
+	var warnings []string
+
+	if isToneMapping(s, videoPath) {
+		if "preserve HDR" == s.HdrMode {
+			warnings = append(warnings, fmt.Sprintf("HDR can be preserved only with H.265, %s is tone mapped to SDR", filepath.Base(videoPath)))
+		}
+		if !hasFfmpegFilter("zscale") {
+			warnings = append(warnings, "ffmpeg is not built with zscale, tone mapping will fail")
+		}
+
+		args["color_primaries"] = "bt709"
+		args["color_trc"] = "bt709"
+		args["colorspace"] = "bt709"
+		return warnings
+	}
+	if "original" == s.VideoCodec {
+		if "tone map to SDR" == s.HdrMode {
+			warnings = append(warnings, fmt.Sprintf("video is copied, %s stays HDR; choose a video codec to tone map it", filepath.Base(videoPath)))
+		}
+		return warnings
+	}
+	if "preserve HDR" != s.HdrMode || "H.265" != s.VideoCodec {
+		return warnings
+	}
+
+	if "compatible" == s.PixelFormat {
+		warnings = append(warnings, "HDR is preserved in 10-bit, compatible pixel format is not applied")
+	}
+
+	idx, _ := probe.videoStream()
+	stream := probe.Streams[idx]
+
+	args["pix_fmt"] = "yuv420p10le"
+	args["color_primaries"] = "bt2020"
+	args["color_trc"] = stream.ColorTransfer
+	args["colorspace"] = "bt2020nc"
+
+	params := []string{
+		"hdr-opt=1",
+		"repeat-headers=1",
+		"colorprim=bt2020",
+		fmt.Sprintf("transfer=%s", stream.ColorTransfer),
+		"colormatrix=bt2020nc",
+	}
+	if display, light := probe.masteringDisplay(); "" != display {
+		params = append(params, fmt.Sprintf("master-display=%s", display))
+		if "" != light {
+			params = append(params, fmt.Sprintf("max-cll=%s", light))
+		}
+	}
+	args["x265-params"] = strings.Join(params, ":")
+
+	return warnings
+}
+
+// hdrVideos returns videos in list which are HDR, with its format
+func hdrVideos() []string {
+	var ret []string
+
+	for _, videoPath := range listOfVideos {
+		probe, _ := videoProbeOf(videoPath)
+		if format := probe.hdrFormat(); "" != format {
+			ret = append(ret, fmt.Sprintf("%s (%s)", filepath.Base(videoPath), format))
+		}
+	}
+
+	return ret
+}
+
+func hdrLayouts() []g.Widget {
+	videos := hdrVideos()
+	if 0 == len(videos) {
+		return nil
+	}
+
+	widgets := []g.Widget{
+		g.Label(fmt.Sprintf("HDR source, colors look washed out unless handled: %s", strings.Join(videos, ", "))).Wrapped(true),
+		g.Row(
+			g.Label("HDR"),
+			g.Dummy(10, 0),
+			g.Combo("##hdrmode", hdrModeComboBoxLists[hdrModeComboBoxIdx], hdrModeComboBoxLists, &hdrModeComboBoxIdx).Size(140).OnChange(func() {
+				hdrModeToUse = hdrModeComboBoxLists[hdrModeComboBoxIdx]
+			}),
+		),
+	}
+
+	switch hdrModeToUse {
+	case "tone map to SDR":
+		widgets = append(widgets, g.Row(
+			g.Label("tone mapping"),
+			g.Combo("##tonemap", tonemapComboBoxLists[tonemapComboBoxIdx], tonemapComboBoxLists, &tonemapComboBoxIdx).Size(100).OnChange(func() {
+				tonemapToUse = tonemapComboBoxLists[tonemapComboBoxIdx]
+			}),
+		))
+	case "preserve HDR":
+		if "H.264" == videoCodecToUse {
+			widgets = append(widgets, g.Label("HDR is preserved only with H.265 (or original) video codec, H.264 is tone mapped"))
+		}
+	}
+
+	return widgets
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+const (
+	historyResultSuccess   = "success"
+	historyResultFailed    = "failed"
+	historyResultCancelled = "cancelled"
+	historyResultSkipped   = "skipped"
+)
+
+// historyEntry is a single completed job, as persisted in history file
+type historyEntry struct {
+	InputPath  string             `json:"input_path"`
+	OutputPath string             `json:"output_path"`
+	Args       []string           `json:"args"`
+	Settings   conversionSettings `json:"settings"`
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt time.Time          `json:"finished_at"`
+	Result     string             `json:"result"`
+	Message    string             `json:"message,omitempty"`
+
+	Loudness     *loudnormMeasurement `json:"loudness,omitempty"`
+	Verification *verification        `json:"verification,omitempty"`
+	Quality      *qualityScore        `json:"quality,omitempty"`
+	CrfSearch    *crfSearch           `json:"crf_search,omitempty"`
+	Crop         *cropArea            `json:"crop,omitempty"`
+}
+
+var historyMutex sync.Mutex
+var historyEntries []historyEntry
+var historyFilter string
+var historySelectedIdx = -1
+var showHistory bool
+
+// appDataDir returns per-user directory to store application data, creating it if needed
+func appDataDir() string {
+	baseDir, err := os.UserConfigDir()
+	if nil != err {
+		baseDir = os.TempDir()
+	}
+
+	dir := filepath.Join(baseDir, "video-converter")
+	os.MkdirAll(dir, os.FileMode(0755))
+
+	return dir
+}
+
+func historyFilePath() string {
+	return filepath.Join(appDataDir(), "history.json")
+}
+
+func loadHistory() error {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	data, err := os.ReadFile(historyFilePath())
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &historyEntries)
+}
+
+func appendHistory(entry historyEntry) error {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	historyEntries = append(historyEntries, entry)
+
+	data, err := json.MarshalIndent(historyEntries, "", "  ")
+	if nil != err {
+		return err
+	}
+
+	return os.WriteFile(historyFilePath(), data, os.FileMode(0644))
+}
+
+// filteredHistory returns indexes of history entries matching filter, newest first
+func filteredHistory(filter string) []int {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	filter = strings.ToLower(strings.TrimSpace(filter))
+
+	var ret []int
+	for i := len(historyEntries) - 1; i >= 0; i-- {
+		entry := historyEntries[i]
+		haystack := strings.ToLower(strings.Join([]string{entry.InputPath, entry.OutputPath, entry.Result}, "\n"))
+		if "" == filter || strings.Contains(haystack, filter) {
+			ret = append(ret, i)
+		}
+	}
+
+	return ret
+}
+
+func historyEntryAt(idx int) (historyEntry, bool) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+
+	if 0 > idx || len(historyEntries) <= idx {
+		return historyEntry{}, false
+	}
+
+	return historyEntries[idx], true
+}
+
+// commandLineString joins args into a single command line, quoted to be pasted on a shell
+func commandLineString(args []string) string {
+	quoted := make([]string, 0, len(args))
+
+	for _, arg := range args {
+		if "" != arg && !strings.ContainsAny(arg, " \t\n\"'\\$`*?;&|<>()[]{}!#~%^") {
+			quoted = append(quoted, arg)
+			continue
+		}
+
+		if "windows" == runtime.GOOS {
+			quoted = append(quoted, `"`+strings.ReplaceAll(arg, `"`, `\"`)+`"`)
+		} else {
+			quoted = append(quoted, `'`+strings.ReplaceAll(arg, `'`, `'\''`)+`'`)
+		}
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// onClickRerunHistory queues source of entry again with its settings, so that it waits for running jobs and can be cancelled
+func onClickRerunHistory(entry historyEntry) {
+	if "" == entry.InputPath {
+		return
+	}
+
+	// source may have changed since, so it is probed again
+	go func() {
+		probe, err := detectWithFfprobe(entry.InputPath)
+		if nil != err {
+			convertingHelperMsg = fmt.Sprintf("cannot re-run %s: %s", entry.InputPath, err)
+			return
+		}
+
+		if _, err := submitJob(entry.InputPath, probe, entry.Settings, "", ""); nil != err {
+			convertingHelperMsg = fmt.Sprintf("cannot re-run %s: %s", entry.InputPath, err)
+		}
+	}()
+}
+
+func historyLayouts() []g.Widget {
+	var widgets []g.Widget
+
+	widgets = append(widgets, []g.Widget{
+		g.Dummy(0, 5),
+		g.Row(
+			g.Button("Back").OnClick(func() {
+				showHistory = false
+			}),
+			g.InputText(&historyFilter).Hint("filter by path or result").Size(-1),
+		),
+	}...)
+
+	var rows []g.Widget
+	for _, idx := range filteredHistory(historyFilter) {
+		idx := idx
+		entry, _ := historyEntryAt(idx)
+		rows = append(rows, g.Selectable(fmt.Sprintf("%s [%s] %s##history%d", entry.StartedAt.Format("2006-01-02 15:04"), entry.Result, filepath.Base(entry.InputPath), idx)).
+			Selected(idx == historySelectedIdx).
+			OnClick(func() {
+				historySelectedIdx = idx
+			}))
+	}
+	if 0 == len(rows) {
+		rows = append(rows, g.Label("no history yet"))
+	}
+
+	widgets = append(widgets, g.Child().Border(true).Size(-1, 150).Layout(rows...))
+
+	if entry, ok := historyEntryAt(historySelectedIdx); ok {
+		details := ""
+		if nil != entry.Verification {
+			details += fmt.Sprintf("\nverified: %t, %.2fs (source %.2fs)", entry.Verification.Passed, entry.Verification.OutputDuration, entry.Verification.SourceDuration)
+		}
+		if nil != entry.Crop {
+			details += fmt.Sprintf("\ncropped: %dx%d at %d,%d", entry.Crop.Width, entry.Crop.Height, entry.Crop.X, entry.Crop.Y)
+		}
+		if nil != entry.CrfSearch {
+			details += fmt.Sprintf("\nsearched: %s", entry.CrfSearch)
+		}
+		if nil != entry.Quality {
+			details += fmt.Sprintf("\nquality: %s", entry.Quality)
+		}
+
+		widgets = append(widgets, []g.Widget{
+			g.Label(fmt.Sprintf("input: %s\noutput: %s\nfinished: %s (%s)\nresult: %s %s%s",
+				entry.InputPath,
+				entry.OutputPath,
+				entry.FinishedAt.Format("2006-01-02 15:04:05"),
+				entry.FinishedAt.Sub(entry.StartedAt).Round(time.Second),
+				entry.Result,
+				entry.Message,
+				details,
+			)).Wrapped(true),
+			g.Row(
+				g.Button("Re-run").OnClick(func() {
+					onClickRerunHistory(entry)
+				}).Disabled("" == entry.InputPath),
+				g.Button("Copy command").OnClick(func() {
+					g.Context.GetPlatform().SetClipboard(commandLineString(entry.Args))
+				}),
+				g.Button("Load settings").OnClick(func() {
+					applySettings(entry.Settings)
+				}).Disabled(isCurrentlyConverting),
+				g.Button("Cancel").OnClick(onClickCancel).Disabled(!isCurrentlyConverting),
+			),
+		}...)
+	}
+
+	widgets = append(widgets, g.Label(convertingHelperMsg).Wrapped(true))
+
+	return widgets
+}
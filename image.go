@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var thumbnailPosition = "10%"
+var frameCount int32 = 9
+var contactSheetColumns int32 = 3
+var clipStart = "0"
+var clipDuration float32 = 3
+var clipFps int32 = 12
+var clipWidth int32 = 480
+
+var embeddedFontOnce sync.Once
+var embeddedFontFilePath string
+var embeddedFontErr error
+
+// isImageOutputMode reports whether current output mode produces images instead of video or audio
+func isImageOutputMode(s conversionSettings) bool {
+	switch s.OutputMode {
+	case "thumbnail", "frames", "contact sheet", "gif", "webp":
+		return true
+	}
+
+	return false
+}
+
+// imageOutputExt returns extension (or file name pattern) of converted file for image output modes
+func imageOutputExt(s conversionSettings) string {
+	switch s.OutputMode {
+	case "frames":
+		return "-%03d.jpg"
+	case "gif":
+		return ".gif"
+	case "webp":
+		return ".webp"
+	}
+
+	return ".jpg"
+}
+
+// duration returns duration of source in seconds, 0 if unknown
+func (o ffprobeOutput) duration() float64 {
+	duration, err := strconv.ParseFloat(o.Format.Duration, 64)
+	if nil != err {
+		return 0
+	}
+
+	return duration
+}
+
+// parsePosition parses position in video such as "50%", "90" (seconds), "01:30" or "00:01:30.5".
+// Returned position is clamped into the duration when the duration is known.
+func parsePosition(s string, duration float64) (float64, error) {
+	s = strings.TrimSpace(s)
+
+	var position float64
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if nil != err {
+			return 0, fmt.Errorf("invalid position %q", s)
+		}
+		if 0 >= duration {
+			return 0, fmt.Errorf("duration of source is unknown, give position in seconds instead of %q", s)
+		}
+		position = duration * percent / 100
+	} else {
+		for _, part := range strings.Split(s, ":") {
+			value, err := strconv.ParseFloat(part, 64)
+			if nil != err {
+				return 0, fmt.Errorf("invalid position %q", s)
+			}
+			position = position*60 + value
+		}
+	}
+
+	if 0 > position {
+		position = 0
+	}
+	// leave some room, seeking exactly at the end gives no frame
+	if 0 < duration && duration-0.1 < position {
+		position = math.Max(0, duration-0.1)
+	}
+
+	return position, nil
+}
+
+// embeddedFontPath writes embedded font into app data directory once, so that ffmpeg can read it.
+// Shared temp directory is avoided, where other users could plant the file or a symlink beforehand.
+func embeddedFontPath() (string, error) {
+	embeddedFontOnce.Do(func() {
+		embeddedFontFilePath = filepath.Join(appDataDir(), "NanumGothic-Regular.ttf")
+		embeddedFontErr = os.WriteFile(embeddedFontFilePath, fontBytes, os.FileMode(0644))
+	})
+
+	return embeddedFontFilePath, embeddedFontErr
+}
+
+// imageKwargs returns input and output kwargs for image output modes
+func imageKwargs(s conversionSettings, videoPath string) (ffmpeg.KwArgs, ffmpeg.KwArgs, error) {
+	inputKwargs := ffmpeg.KwArgs{}
+	outputKwargs := ffmpeg.KwArgs{
+		"an": "",
+		"sn": "",
+		"dn": "",
+	}
+
+	probe, _ := videoProbeOf(videoPath)
+	duration := probe.duration()
+
+	switch s.OutputMode {
+	case "thumbnail":
+		position, err := parsePosition(s.ThumbnailPosition, duration)
+		if nil != err {
+			return nil, nil, err
+		}
+
+		inputKwargs["ss"] = strconv.FormatFloat(position, 'f', 3, 64)
+		outputKwargs["frames:v"] = "1"
+		outputKwargs["q:v"] = "2"
+	case "frames", "contact sheet":
+		if 0 >= duration {
+			return nil, nil, fmt.Errorf("duration of source is unknown, cannot space frames evenly")
+		}
+		if 0 >= s.FrameCount {
+			return nil, nil, fmt.Errorf("number of frames should be positive")
+		}
+
+		// take frame at the middle of each interval, first frame of video is often black
+		interval := duration / float64(s.FrameCount)
+		offset := strconv.FormatFloat(interval/2, 'f', 3, 64)
+		inputKwargs["ss"] = offset
+		filters := []string{fmt.Sprintf("fps=1/%.6f", interval)}
+		outputKwargs["q:v"] = "2"
+
+		if "frames" == s.OutputMode {
+			outputKwargs["frames:v"] = strconv.Itoa(int(s.FrameCount))
+		} else {
+			if 0 >= s.ContactSheetColumns {
+				return nil, nil, fmt.Errorf("number of columns should be positive")
+			}
+
+			fontPath, err := embeddedFontPath()
+			if nil != err {
+				return nil, nil, err
+			}
+
+			rows := (s.FrameCount + s.ContactSheetColumns - 1) / s.ContactSheetColumns
+			// timestamps restart from 0 at seeked position, so that offset is added back to label source position
+			filters = append(filters,
+				"scale=320:-2",
+				fmt.Sprintf("drawtext=fontfile=%s:text='%%{pts\\:hms\\:%s}':x=5:y=h-th-5:fontsize=16:fontcolor=white:box=1:boxcolor=black@0.5", quoteFilterOption(fontPath), offset),
+				fmt.Sprintf("tile=%dx%d:padding=4:margin=4", s.ContactSheetColumns, rows),
+			)
+			outputKwargs["frames:v"] = "1"
+		}
+
+		outputKwargs["filter:v"] = strings.Join(filters, ",")
+	case "gif", "webp":
+		position, err := parsePosition(s.ClipStart, duration)
+		if nil != err {
+			return nil, nil, err
+		}
+		if 0 >= s.ClipDuration || 0 >= s.ClipFps || 0 >= s.ClipWidth {
+			return nil, nil, fmt.Errorf("clip duration, fps and width should be positive")
+		}
+
+		inputKwargs["ss"] = strconv.FormatFloat(position, 'f', 3, 64)
+		outputKwargs["t"] = strconv.FormatFloat(float64(s.ClipDuration), 'f', 3, 32)
+		outputKwargs["loop"] = "0"
+
+		filters := fmt.Sprintf("fps=%d,scale=%d:-2:flags=lanczos", s.ClipFps, s.ClipWidth)
+		if "gif" == s.OutputMode {
+			// gif has only 256 colors, generating palette from the clip itself keeps it from dithering badly
+			outputKwargs["filter:v"] = filters + ",split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse"
+		} else {
+			outputKwargs["filter:v"] = filters
+			outputKwargs["c:v"] = "libwebp"
+			outputKwargs["q:v"] = "70"
+		}
+	}
+
+	return inputKwargs, outputKwargs, nil
+}
+
+func imageLayouts() []g.Widget {
+	var widgets []g.Widget
+
+	switch outputModeToUse {
+	case "thumbnail":
+		widgets = append(widgets, g.InputText(&thumbnailPosition).Label("position").Hint("50%, 90 or 00:01:30").Size(120))
+	case "frames":
+		widgets = append(widgets, g.InputInt(&frameCount).Label("number of frames").Size(100))
+	case "contact sheet":
+		widgets = append(widgets, g.Row(
+			g.InputInt(&frameCount).Label("frames").Size(80),
+			g.InputInt(&contactSheetColumns).Label("columns").Size(80),
+		))
+	case "gif", "webp":
+		widgets = append(widgets, []g.Widget{
+			g.Row(
+				g.InputText(&clipStart).Label("start").Hint("50%, 90 or 00:01:30").Size(80),
+				g.InputFloat(&clipDuration).Label("seconds").Format("%.1f").Size(60),
+			),
+			g.Row(
+				g.InputInt(&clipFps).Label("fps").Size(80),
+				g.InputInt(&clipWidth).Label("width").Size(80),
+			),
+		}...)
+	}
+
+	return widgets
+}
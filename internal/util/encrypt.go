@@ -1,59 +1,150 @@
 package util
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
-	"strconv"
+	"os"
+	"path/filepath"
 )
 
-// encrypt/decrypt key
-var encdecKey []byte
+// encrypted data starts with magic and version, followed by nonce and sealed data.
+// Header is authenticated as additional data, so it cannot be altered either.
+const (
+	encryptionMagic = "VCENC"
+	// version 1 derived key from hardware address, version 2 uses random key of key file as is
+	encryptionVersion = byte(2)
+	// KeySize is size of AES-256 key
+	KeySize = 32
+)
 
-func init() {
-	uintMac := MacUInt64()
-	encdecKey = []byte(strconv.FormatUint(uintMac, 8)) // unique in same mac address
-}
+var (
+	// ErrInvalidKey is returned when key is not KeySize bytes
+	ErrInvalidKey = fmt.Errorf("encryption key must be %d bytes", KeySize)
+	// ErrInvalidKeyFile is returned when key file exists but does not hold a key
+	ErrInvalidKeyFile = errors.New("key file is not a valid key")
+	// ErrNotEncrypted is returned when data does not start with encryption header
+	ErrNotEncrypted = errors.New("given data is not encrypted by this application")
+	// ErrDecryptFailed is returned when data is corrupted or encrypted with another key
+	ErrDecryptFailed = errors.New("cannot decrypt: data is corrupted or encrypted with another key")
+)
 
-// Encrypt encrypts input byte slice
-func Encrypt(input []byte) ([]byte, error) {
-	c, err := aes.NewCipher(encdecKey)
+func readKeyFile(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
 	if nil != err {
 		return nil, err
 	}
+	if KeySize != len(key) {
+		return nil, ErrInvalidKeyFile
+	}
+
+	return key, nil
+}
+
+// LoadOrCreateKey returns random key kept in file at path, creating the file readable only by current user
+// when it does not exist yet
+func LoadOrCreateKey(path string) ([]byte, error) {
+	key, err := readKeyFile(path)
+	if !os.IsNotExist(err) {
+		return key, err
+	}
+
+	key = make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); nil != err {
+		return nil, err
+	}
 
-	gcm, err := cipher.NewGCM(c)
+	// key is written completely into a temporary file first, then linked to path, which fails
+	// instead of overwriting when another process created the key at the same time
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if nil != err {
 		return nil, err
 	}
+	defer os.Remove(tmp.Name())
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+	if _, err := tmp.Write(key); nil != err {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); nil != err {
+		return nil, err
+	}
+
+	if err := os.Link(tmp.Name(), path); nil != err {
+		if os.IsExist(err) {
+			return readKeyFile(path)
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if KeySize != len(key) {
+		return nil, ErrInvalidKey
+	}
+
+	c, err := aes.NewCipher(key)
+	if nil != err {
 		return nil, err
 	}
 
-	return gcm.Seal(nonce, nonce, input, nil), nil
+	return cipher.NewGCM(c)
 }
 
-// Decrypt decrypts input byte slice
-func Decrypt(input []byte) ([]byte, error) {
-	c, err := aes.NewCipher(encdecKey)
+// Encrypt encrypts input byte slice with key of KeySize bytes
+func Encrypt(key, input []byte) ([]byte, error) {
+	header := append([]byte(encryptionMagic), encryptionVersion)
+
+	gcm, err := newGCM(key)
 	if nil != err {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(c)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); nil != err {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(header)+len(nonce)+len(input)+gcm.Overhead())
+	out = append(append(out, header...), nonce...)
+
+	return gcm.Seal(out, nonce, input, header), nil
+}
+
+// Decrypt decrypts input byte slice encrypted by Encrypt with the same key
+func Decrypt(key, input []byte) ([]byte, error) {
+	headerSize := len(encryptionMagic) + 1
+	if len(input) < headerSize || !bytes.Equal([]byte(encryptionMagic), input[:len(encryptionMagic)]) {
+		return nil, ErrNotEncrypted
+	}
+
+	header := input[:headerSize]
+	if version := header[headerSize-1]; encryptionVersion != version {
+		return nil, fmt.Errorf("%w: unsupported encryption version %d", ErrDecryptFailed, version)
+	}
+	input = input[headerSize:]
+
+	gcm, err := newGCM(key)
 	if nil != err {
 		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(input) < nonceSize {
-		return nil, fmt.Errorf("given bad data")
+		return nil, ErrDecryptFailed
 	}
-
 	nonce, input := input[:nonceSize], input[nonceSize:]
-	return gcm.Open(nil, nonce, input, nil)
+
+	output, err := gcm.Open(nil, nonce, input, header)
+	if nil != err {
+		return nil, ErrDecryptFailed
+	}
+
+	return output, nil
 }
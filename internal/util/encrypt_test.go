@@ -0,0 +1,182 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// testKey returns key of KeySize bytes filled with b
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	key := testKey(1)
+	plain := []byte(`{"api_token":"abc"}`)
+
+	encrypted, err := Encrypt(key, plain)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(encrypted, append([]byte(encryptionMagic), encryptionVersion)) {
+		t.Errorf("encrypted data does not start with version header: %x", encrypted[:8])
+	}
+	if bytes.Contains(encrypted, plain) {
+		t.Error("encrypted data contains plain text")
+	}
+
+	decrypted, err := Decrypt(key, encrypted)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, decrypted) {
+		t.Errorf("decrypted %q, expected %q", decrypted, plain)
+	}
+}
+
+func TestEncryptUsesRandomNonce(t *testing.T) {
+	key := testKey(1)
+
+	first, err := Encrypt(key, []byte("same"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	second, err := Encrypt(key, []byte("same"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	headerSize := len(encryptionMagic) + 1
+	if bytes.Equal(first[headerSize:headerSize+12], second[headerSize:headerSize+12]) {
+		t.Error("nonce is reused between encryptions")
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	key := testKey(1)
+	encrypted, err := Encrypt(key, []byte("plain"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if _, err := Decrypt(testKey(2), encrypted); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("wrong key: got %v, expected %v", err, ErrDecryptFailed)
+	}
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Decrypt(key, tampered); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("tampered data: got %v, expected %v", err, ErrDecryptFailed)
+	}
+
+	if _, err := Decrypt(key, encrypted[:len(encryptionMagic)+1+4]); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("truncated data: got %v, expected %v", err, ErrDecryptFailed)
+	}
+
+	if _, err := Decrypt(key, []byte("plain text")); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("plain data: got %v, expected %v", err, ErrNotEncrypted)
+	}
+
+	future := append([]byte(nil), encrypted...)
+	future[len(encryptionMagic)] = encryptionVersion + 1
+	if _, err := Decrypt(key, future); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("unsupported version: got %v, expected %v", err, ErrDecryptFailed)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("short"), bytes.Repeat([]byte{1}, KeySize+1)} {
+		if _, err := Encrypt(key, []byte("plain")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("encrypt with %d bytes key: got %v, expected %v", len(key), err, ErrInvalidKey)
+		}
+	}
+
+	encrypted, err := Encrypt(testKey(1), []byte("plain"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(nil, encrypted); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("decrypt: got %v, expected %v", err, ErrInvalidKey)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.key")
+
+	key, err := LoadOrCreateKey(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if KeySize != len(key) {
+		t.Errorf("key is %d bytes, expected %d", len(key), KeySize)
+	}
+
+	if "windows" != runtime.GOOS {
+		stat, err := os.Stat(path)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if mode := stat.Mode().Perm(); os.FileMode(0600) != mode {
+			t.Errorf("key file mode is %o, expected 600", mode)
+		}
+	}
+
+	loaded, err := LoadOrCreateKey(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, loaded) {
+		t.Error("key is not kept between loads")
+	}
+
+	other, err := LoadOrCreateKey(filepath.Join(t.TempDir(), "settings.key"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if bytes.Equal(key, other) {
+		t.Error("new key file has the same key")
+	}
+
+	if err := os.WriteFile(path, []byte("short"), os.FileMode(0600)); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := LoadOrCreateKey(path); !errors.Is(err, ErrInvalidKeyFile) {
+		t.Errorf("got %v, expected %v", err, ErrInvalidKeyFile)
+	}
+}
+
+func TestLoadOrCreateKeyConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.key")
+
+	keys := make([][]byte, 8)
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], errs[i] = LoadOrCreateKey(path)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range keys {
+		if nil != errs[i] {
+			t.Fatal(errs[i])
+		}
+		if !bytes.Equal(keys[0], keys[i]) {
+			t.Error("instances starting at the same time got different keys")
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	if 0 != len(matches) {
+		t.Errorf("temporary files are left: %v", matches)
+	}
+}
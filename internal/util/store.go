@@ -0,0 +1,131 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store is a small key-value store persisted into a single encrypted file.
+// It is meant for preferences and sensitive values such as tokens or credentials.
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	key    []byte
+	values map[string]string
+}
+
+// OpenStore opens store at path, encrypted with key of KeySize bytes.
+// A missing file is an empty store, it is created on first write.
+func OpenStore(path string, key []byte) (*Store, error) {
+	if KeySize != len(key) {
+		return nil, ErrInvalidKey
+	}
+
+	s := &Store{
+		path:   path,
+		key:    key,
+		values: map[string]string{},
+	}
+
+	data, err := os.ReadFile(path)
+	if nil != err {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	plain, err := Decrypt(key, data)
+	if nil != err {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(plain, &s.values); nil != err {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// OpenKeyFileStore opens store at path, encrypted with random key kept in file at keyPath
+func OpenKeyFileStore(path, keyPath string) (*Store, error) {
+	key, err := LoadOrCreateKey(keyPath)
+	if nil != err {
+		return nil, err
+	}
+
+	return OpenStore(path, key)
+}
+
+// Get returns value of key, and whether it exists
+func (s *Store) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[key]
+	return value, ok
+}
+
+// Keys returns every key in store, sorted
+func (s *Store) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Set stores value of key, then persists store
+func (s *Store) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+	return s.save()
+}
+
+// Delete removes key, then persists store
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, key)
+	return s.save()
+}
+
+// save writes store into a temporary file first and renames it, so that a crash never leaves half written store
+func (s *Store) save() error {
+	plain, err := json.Marshal(s.values)
+	if nil != err {
+		return err
+	}
+
+	data, err := Encrypt(s.key, plain)
+	if nil != err {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if nil != err {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); nil != err {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); nil != err {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.enc")
+	key := testKey(1)
+
+	store, err := OpenStore(path, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 0 != len(store.Keys()) {
+		t.Errorf("new store has keys %v", store.Keys())
+	}
+
+	if err := store.Set("api_token", "abc"); nil != err {
+		t.Fatal(err)
+	}
+	if err := store.Set("preferences", "{}"); nil != err {
+		t.Fatal(err)
+	}
+	if err := store.Delete("preferences"); nil != err {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("abc")) {
+		t.Error("store file contains plain value")
+	}
+
+	reopened, err := OpenStore(path, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if value, ok := reopened.Get("api_token"); !ok || "abc" != value {
+		t.Errorf("api_token = %q, %v, expected %q", value, ok, "abc")
+	}
+	if _, ok := reopened.Get("preferences"); ok {
+		t.Error("deleted key is persisted")
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	if 0 != len(matches) {
+		t.Errorf("temporary files are left: %v", matches)
+	}
+}
+
+func TestStoreWrongKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.enc")
+
+	store, err := OpenStore(path, testKey(1))
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := store.Set("api_token", "abc"); nil != err {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenStore(path, testKey(2)); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("got %v, expected %v", err, ErrDecryptFailed)
+	}
+}
+
+func TestStoreInvalidKey(t *testing.T) {
+	if _, err := OpenStore(filepath.Join(t.TempDir(), "settings.enc"), nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got %v, expected %v", err, ErrInvalidKey)
+	}
+}
+
+func TestKeyFileStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.enc")
+	keyPath := filepath.Join(dir, "settings.key")
+
+	store, err := OpenKeyFileStore(path, keyPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err := store.Set("api_token", "abc"); nil != err {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenKeyFileStore(path, keyPath)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if value, _ := reopened.Get("api_token"); "abc" != value {
+		t.Errorf("api_token = %q, expected %q", value, "abc")
+	}
+
+	// a lost key makes a new one, which cannot read the store
+	if err := os.Remove(keyPath); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := OpenKeyFileStore(path, keyPath); !errors.Is(err, ErrDecryptFailed) {
+		t.Errorf("got %v, expected %v", err, ErrDecryptFailed)
+	}
+}
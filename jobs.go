@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	jobStatusQueued  = "queued"
+	jobStatusRunning = "running"
+	// finished jobs take history result (success, failed or cancelled) as status
+)
+
+// logTailSize is how many bytes of ffmpeg output are kept on job for its report
+const logTailSize = 8192
+
+// job is a single conversion in queue, submitted either from GUI or HTTP API
+type job struct {
+	ID         string             `json:"id"`
+	InputPath  string             `json:"input_path"`
+	OutputPath string             `json:"output_path,omitempty"`
+	Preset     string             `json:"preset,omitempty"`
+	BatchID    string             `json:"batch_id"`
+	Settings   conversionSettings `json:"settings"`
+	Status     string             `json:"status"`
+	// Progress is ratio of converted duration to source duration, within [0, 1]
+	Progress   float64   `json:"progress"`
+	Message    string    `json:"message,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Actions are results of post-job actions, and post-batch actions on the last job of a batch
+	Actions []actionResult `json:"actions,omitempty"`
+
+	probe   ffprobeOutput
+	entry   *historyEntry
+	logTail []byte
+	// cancelHooks kills hook commands of the job and of its batch, set only while they run
+	cancelHooks context.CancelFunc
+}
+
+// jobReport is everything known about a job, including the history entry once it is finished
+type jobReport struct {
+	Job     job           `json:"job"`
+	History *historyEntry `json:"history,omitempty"`
+	Log     string        `json:"log"`
+}
+
+var jobsMutex sync.Mutex
+var jobs []*job
+var lastJobID int
+var lastBatchID int
+var finishedBatches = map[string]bool{}
+
+// openBatches are batches still being submitted, their post-batch actions wait until closeBatch
+var openBatches = map[string]bool{}
+var jobQueue = make(chan *job, 1024)
+var jobSubscribers = map[chan job]struct{}{}
+var jobWorkerOnce sync.Once
+
+// setVideoProbe stores probe of videoPath, GUI drops and job worker both store probes
+func setVideoProbe(videoPath string, probe ffprobeOutput) {
+	listOfVideoProbesMutex.Lock()
+	defer listOfVideoProbesMutex.Unlock()
+
+	listOfVideoProbes[videoPath] = probe
+}
+
+// videoProbeOf returns stored probe of videoPath, zero probe and false when it is not probed
+func videoProbeOf(videoPath string) (ffprobeOutput, bool) {
+	listOfVideoProbesMutex.Lock()
+	defer listOfVideoProbesMutex.Unlock()
+
+	probe, ok := listOfVideoProbes[videoPath]
+	return probe, ok
+}
+
+// newBatchID returns id grouping jobs submitted together, post-batch actions run once all of them finish.
+// The batch stays open until closeBatch, so that jobs finishing during submission do not finish it early.
+func newBatchID() string {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	lastBatchID++
+	batchID := fmt.Sprintf("batch-%d", lastBatchID)
+	openBatches[batchID] = true
+
+	return batchID
+}
+
+// closeBatch tells every job of batchID is submitted, finishing it right away when all of them are already done
+func closeBatch(batchID string) {
+	jobsMutex.Lock()
+	delete(openBatches, batchID)
+	var last *job
+	for _, j := range jobs {
+		if batchID == j.BatchID {
+			last = j
+		}
+	}
+	jobsMutex.Unlock()
+
+	if nil != last {
+		finishBatch(context.Background(), last)
+	}
+}
+
+// submitJob queues conversion of videoPath with given settings, jobs run one by one in submitted order.
+// Options missing in settings (e.g. preset of older version) are taken from GUI at submission.
+// Empty batchID makes the job a batch of its own.
+func submitJob(videoPath string, probe ffprobeOutput, settings conversionSettings, preset, batchID string) (job, error) {
+	jobWorkerOnce.Do(func() {
+		go runJobs()
+	})
+
+	jobsMutex.Lock()
+	lastJobID++
+	j := &job{
+		ID:        strconv.Itoa(lastJobID),
+		BatchID:   batchID,
+		InputPath: videoPath,
+		Preset:    preset,
+		Settings:  settings.withDefaults(publishedSettings()),
+		Status:    jobStatusQueued,
+		CreatedAt: time.Now(),
+		probe:     probe,
+	}
+	if "" == j.BatchID {
+		j.BatchID = "job-" + j.ID
+	}
+	jobs = append(jobs, j)
+	snapshot := *j
+	jobsMutex.Unlock()
+
+	publishJob(snapshot)
+	persistQueue()
+
+	select {
+	case jobQueue <- j:
+	default:
+		finishJobWith(j, historyResultFailed, "queue is full")
+		return jobSnapshot(j), fmt.Errorf("queue is full")
+	}
+
+	return snapshot, nil
+}
+
+func jobSnapshot(j *job) job {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	return *j
+}
+
+func findJob(id string) (*job, bool) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	for _, j := range jobs {
+		if id == j.ID {
+			return j, true
+		}
+	}
+
+	return nil, false
+}
+
+// listJobs returns snapshot of every job, oldest first
+func listJobs() []job {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	ret := make([]job, 0, len(jobs))
+	for _, j := range jobs {
+		ret = append(ret, *j)
+	}
+
+	return ret
+}
+
+func reportOf(j *job) jobReport {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	return jobReport{
+		Job:     *j,
+		History: j.entry,
+		Log:     string(j.logTail),
+	}
+}
+
+// cancelJob cancels queued job right away, running job is cancelled by killing ffmpeg,
+// or its hook commands once conversion is over
+func cancelJob(j *job) job {
+	jobsMutex.Lock()
+	cancelHooks := j.cancelHooks
+	jobsMutex.Unlock()
+	if nil != cancelHooks {
+		cancelHooks()
+		return jobSnapshot(j)
+	}
+
+	switch jobSnapshot(j).Status {
+	case jobStatusQueued:
+		finishJobWith(j, historyResultCancelled, "cancelled before start")
+	case jobStatusRunning:
+		// nobody receives when ffmpeg is not running (e.g. between loudness passes), don't block on it
+		select {
+		case ffmpegCancelChannel <- struct{}{}:
+		default:
+		}
+	}
+
+	return jobSnapshot(j)
+}
+
+// cancelRunningJob cancels the job currently converting, if any
+func cancelRunningJob() {
+	jobsMutex.Lock()
+	var running *job
+	for _, j := range jobs {
+		if jobStatusRunning == j.Status {
+			running = j
+		}
+	}
+	jobsMutex.Unlock()
+
+	if nil != running {
+		cancelJob(running)
+	}
+}
+
+func finishJobWith(j *job, result, message string) {
+	jobsMutex.Lock()
+	j.Status = result
+	j.Message = message
+	j.FinishedAt = time.Now()
+	snapshot := *j
+	jobsMutex.Unlock()
+
+	publishJob(snapshot)
+	persistQueue()
+}
+
+// runJobs converts queued jobs one by one, each with its own settings
+func runJobs() {
+	for j := range jobQueue {
+		// pause instead of letting ffmpeg fail halfway through with full disk
+		waitForDiskSpace(j)
+
+		jobsMutex.Lock()
+		if jobStatusQueued != j.Status {
+			jobsMutex.Unlock()
+			// job cancelled before start may be the last one of its batch
+			finishBatch(context.Background(), j)
+			continue
+		}
+		j.Status = jobStatusRunning
+		j.StartedAt = time.Now()
+		snapshot := *j
+		jobsMutex.Unlock()
+		publishJob(snapshot)
+
+		isConversionPreparing = true
+		convertingHelperMsg = ""
+
+		setVideoProbe(j.InputPath, j.probe)
+		entry := convertSingleVideo(j.Settings, j.InputPath, &jobProgressWriter{job: j, duration: j.probe.duration()})
+
+		// hooks are cancelled with the job from here on, ffmpeg is not running any more
+		ctx, cancel := context.WithCancel(context.Background())
+		jobsMutex.Lock()
+		j.cancelHooks = cancel
+		jobsMutex.Unlock()
+
+		actions := runJobActions(ctx, j.Settings, entry)
+		if failures := actionFailures(actions); 0 < len(failures) {
+			convertingHelperMsg += "\n" + strings.Join(failures, "\n")
+		}
+
+		jobsMutex.Lock()
+		j.entry = &entry
+		j.OutputPath = entry.OutputPath
+		j.Actions = actions
+		if historyResultSuccess == entry.Result {
+			j.Progress = 1
+		}
+		jobsMutex.Unlock()
+		finishJobWith(j, entry.Result, entry.Message)
+
+		finishBatch(ctx, j)
+
+		jobsMutex.Lock()
+		j.cancelHooks = nil
+		jobsMutex.Unlock()
+		cancel()
+
+		isConversionPreparing = false
+
+		// deliberate sleep before finish
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// finishBatch runs post-batch actions with settings of j when the batch is closed and no job of it is left to run.
+// Results are appended to actions of j, which is the last job of the batch.
+func finishBatch(ctx context.Context, j *job) {
+	jobsMutex.Lock()
+	if finishedBatches[j.BatchID] || openBatches[j.BatchID] {
+		jobsMutex.Unlock()
+		return
+	}
+
+	var batch []job
+	for _, other := range jobs {
+		if j.BatchID != other.BatchID {
+			continue
+		}
+		if jobStatusQueued == other.Status || jobStatusRunning == other.Status {
+			jobsMutex.Unlock()
+			return
+		}
+		batch = append(batch, *other)
+	}
+	finishedBatches[j.BatchID] = true
+	settings := j.Settings
+	jobsMutex.Unlock()
+
+	actions := runBatchActions(ctx, settings, batch)
+	if 0 == len(actions) {
+		return
+	}
+	if failures := actionFailures(actions); 0 < len(failures) {
+		convertingHelperMsg += "\n" + strings.Join(failures, "\n")
+	}
+
+	jobsMutex.Lock()
+	j.Actions = append(j.Actions, actions...)
+	snapshot := *j
+	jobsMutex.Unlock()
+
+	publishJob(snapshot)
+}
+
+// subscribeJobs returns channel receiving snapshot of a job whenever it changes
+func subscribeJobs() chan job {
+	ch := make(chan job, 64)
+
+	jobsMutex.Lock()
+	jobSubscribers[ch] = struct{}{}
+	jobsMutex.Unlock()
+
+	return ch
+}
+
+func unsubscribeJobs(ch chan job) {
+	jobsMutex.Lock()
+	delete(jobSubscribers, ch)
+	jobsMutex.Unlock()
+}
+
+// publishJob sends snapshot to subscribers, slow subscribers miss events instead of blocking conversion
+func publishJob(snapshot job) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	for ch := range jobSubscribers {
+		select {
+		case ch <- snapshot:
+		default:
+		}
+	}
+}
+
+var ffmpegTimeRegexp = regexp.MustCompile(`time=(\d+:\d+:\d+(?:\.\d+)?)`)
+
+// jobProgressWriter receives ffmpeg output of a job, keeping its tail and updating progress from "time=" status
+type jobProgressWriter struct {
+	job      *job
+	duration float64
+}
+
+func (w *jobProgressWriter) Write(p []byte) (int, error) {
+	jobsMutex.Lock()
+	w.job.logTail = append(w.job.logTail, p...)
+	if logTailSize < len(w.job.logTail) {
+		w.job.logTail = append([]byte(nil), w.job.logTail[len(w.job.logTail)-logTailSize:]...)
+	}
+
+	matches := ffmpegTimeRegexp.FindAllSubmatch(p, -1)
+	if 0 == len(matches) || 0 >= w.duration {
+		jobsMutex.Unlock()
+		return len(p), nil
+	}
+
+	position, err := parsePosition(string(matches[len(matches)-1][1]), 0)
+	if nil == err {
+		w.job.Progress = position / w.duration
+		if 1 < w.job.Progress {
+			w.job.Progress = 1
+		}
+	}
+	snapshot := *w.job
+	jobsMutex.Unlock()
+
+	publishJob(snapshot)
+
+	return len(p), nil
+}
@@ -10,10 +10,10 @@ import (
 	"os"
 	"os/exec"
 	"path"
-	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/text/unicode/norm"
@@ -28,6 +28,10 @@ import (
 var IS_DEV = false
 
 var listOfVideos []string
+
+// listOfVideoProbes is only accessed through setVideoProbe and videoProbeOf, GUI and job worker share it
+var listOfVideoProbesMutex sync.Mutex
+var listOfVideoProbes = map[string]ffprobeOutput{}
 var isFfmpegReady bool
 var tmpbinPath string
 var isConversionPreparing bool
@@ -39,9 +43,13 @@ var ffmpegCancelChannel = make(chan struct{})
 
 var resComboBoxLists = []string{
 	"original",
+	"360p",
 	"480p",
 	"720p",
 	"1080p",
+	"1440p",
+	"2160p",
+	"custom",
 }
 var resComboBoxIdx int32 = 0
 var resToUse = "original"
@@ -84,13 +92,594 @@ func init() {
 	g.SetDefaultFontFromBytes(fontBytes, 16)
 }
 
-func ffmpegOutputKwargs() ffmpeg.KwArgs {
+// conversionSettings is snapshot of options selected on GUI
+type conversionSettings struct {
+	Resolution      string `json:"resolution"`
+	AudioCodec      string `json:"audio_codec"`
+	VideoCodec      string `json:"video_codec"`
+	ContainerFormat string `json:"container_format"`
+	FilePrefix      string `json:"file_prefix"`
+	OutputMode      string `json:"output_mode,omitempty"`
+	AudioFormat     string `json:"audio_format,omitempty"`
+
+	CustomWidth  int32  `json:"custom_width,omitempty"`
+	CustomHeight int32  `json:"custom_height,omitempty"`
+	AspectMode   string `json:"aspect_mode,omitempty"`
+	NeverUpscale bool   `json:"never_upscale"`
+
+	FrameRate                  string  `json:"frame_rate,omitempty"`
+	CustomFrameRate            float32 `json:"custom_frame_rate,omitempty"`
+	ForceConstantFrameRate     bool    `json:"force_constant_frame_rate"`
+	NormalizeVariableFrameRate bool    `json:"normalize_variable_frame_rate"`
+
+	AudioNormalize      bool    `json:"audio_normalize,omitempty"`
+	TargetLoudness      float32 `json:"target_loudness,omitempty"`
+	TargetTruePeak      float32 `json:"target_true_peak,omitempty"`
+	TargetLoudnessRange float32 `json:"target_loudness_range,omitempty"`
+	VolumeGain          float32 `json:"volume_gain,omitempty"`
+	AudioChannels       string  `json:"audio_channels,omitempty"`
+	AudioSampleRate     string  `json:"audio_sample_rate,omitempty"`
+
+	MetadataMode     string `json:"metadata_mode,omitempty"`
+	KeepChapters     bool   `json:"keep_chapters"`
+	KeepAttachments  bool   `json:"keep_attachments"`
+	KeepCreationTime bool   `json:"keep_creation_time"`
+	MetadataTitle    string `json:"metadata_title,omitempty"`
+	MetadataArtist   string `json:"metadata_artist,omitempty"`
+	MetadataComment  string `json:"metadata_comment,omitempty"`
+
+	ThumbnailPosition   string  `json:"thumbnail_position,omitempty"`
+	FrameCount          int32   `json:"frame_count,omitempty"`
+	ContactSheetColumns int32   `json:"contact_sheet_columns,omitempty"`
+	ClipStart           string  `json:"clip_start,omitempty"`
+	ClipDuration        float32 `json:"clip_duration,omitempty"`
+	ClipFps             int32   `json:"clip_fps,omitempty"`
+	ClipWidth           int32   `json:"clip_width,omitempty"`
+
+	Deinterlace       string  `json:"deinterlace,omitempty"`
+	DeinterlaceFilter string  `json:"deinterlace_filter,omitempty"`
+	Denoise           string  `json:"denoise,omitempty"`
+	DenoiseStrength   string  `json:"denoise_strength,omitempty"`
+	Sharpen           bool    `json:"sharpen,omitempty"`
+	SharpenAmount     float32 `json:"sharpen_amount,omitempty"`
+	CropMode          string  `json:"crop_mode,omitempty"`
+	CropTop           int32   `json:"crop_top,omitempty"`
+	CropBottom        int32   `json:"crop_bottom,omitempty"`
+	CropLeft          int32   `json:"crop_left,omitempty"`
+	CropRight         int32   `json:"crop_right,omitempty"`
+	Rotate            string  `json:"rotate,omitempty"`
+	FlipHorizontal    bool    `json:"flip_horizontal,omitempty"`
+	FlipVertical      bool    `json:"flip_vertical,omitempty"`
+	PlaybackSpeed     float32 `json:"playback_speed,omitempty"`
+
+	WatermarkImage    string  `json:"watermark_image,omitempty"`
+	WatermarkPosition string  `json:"watermark_position,omitempty"`
+	WatermarkOpacity  float32 `json:"watermark_opacity,omitempty"`
+	WatermarkScale    float32 `json:"watermark_scale,omitempty"`
+	OverlayText       string  `json:"overlay_text,omitempty"`
+	TextPosition      string  `json:"text_position,omitempty"`
+	TextFont          string  `json:"text_font,omitempty"`
+	TextSize          int32   `json:"text_size,omitempty"`
+	TextColor         string  `json:"text_color,omitempty"`
+	TextBox           bool    `json:"text_box,omitempty"`
+	TextBoxColor      string  `json:"text_box_color,omitempty"`
+	OverlayMargin     int32   `json:"overlay_margin,omitempty"`
+
+	StreamingFormat       string       `json:"streaming_format,omitempty"`
+	SegmentDuration       int32        `json:"segment_duration,omitempty"`
+	StreamingAudioBitrate int32        `json:"streaming_audio_bitrate,omitempty"`
+	StreamingLadder       []ladderRung `json:"streaming_ladder,omitempty"`
+
+	DeleteLargerOutput     bool   `json:"delete_larger_output,omitempty"`
+	OriginalsAction        string `json:"originals_action,omitempty"`
+	OriginalsFolder        string `json:"originals_folder,omitempty"`
+	OriginalsRenamePattern string `json:"originals_rename_pattern,omitempty"`
+	JobHook                string `json:"job_hook,omitempty"`
+	RevealOutput           bool   `json:"reveal_output,omitempty"`
+	BatchHook              string `json:"batch_hook,omitempty"`
+
+	MatchingSource string `json:"matching_source,omitempty"`
+	SkipCodec      string `json:"skip_codec,omitempty"`
+
+	VerifyOutput      bool    `json:"verify_output"`
+	FullDecodeCheck   bool    `json:"full_decode_check"`
+	DurationTolerance float32 `json:"duration_tolerance,omitempty"`
+
+	QualityMetric string `json:"quality_metric,omitempty"`
+
+	RateControl         string  `json:"rate_control,omitempty"`
+	TargetQualityMetric string  `json:"target_quality_metric,omitempty"`
+	TargetQualityScore  float32 `json:"target_quality_score,omitempty"`
+	CrfSearchSamples    int32   `json:"crf_search_samples,omitempty"`
+
+	PixelFormat string `json:"pixel_format,omitempty"`
+
+	WebOptimized bool   `json:"web_optimized,omitempty"`
+	H264Profile  string `json:"h264_profile,omitempty"`
+	H264Level    string `json:"h264_level,omitempty"`
+
+	HdrMode string `json:"hdr_mode,omitempty"`
+	Tonemap string `json:"tonemap,omitempty"`
+
+	PreviewOffset   string `json:"preview_offset,omitempty"`
+	PreviewDuration int32  `json:"preview_duration,omitempty"`
+
+	AdvancedMode        bool   `json:"advanced_mode,omitempty"`
+	AdvancedInputArgs   string `json:"advanced_input_args,omitempty"`
+	AdvancedOutputArgs  string `json:"advanced_output_args,omitempty"`
+	AdvancedVideoFilter string `json:"advanced_video_filter,omitempty"`
+	AdvancedAudioFilter string `json:"advanced_audio_filter,omitempty"`
+}
+
+// guiSettings is copy of GUI settings published by GUI thread, for goroutines which must not read GUI globals
+var guiSettingsMutex sync.Mutex
+var guiSettings conversionSettings
+
+func publishSettings(s conversionSettings) {
+	guiSettingsMutex.Lock()
+	guiSettings = s
+	guiSettingsMutex.Unlock()
+}
+
+// publishedSettings returns GUI settings as of last frame, safe to call from any goroutine
+func publishedSettings() conversionSettings {
+	guiSettingsMutex.Lock()
+	defer guiSettingsMutex.Unlock()
+
+	return guiSettings
+}
+
+// currentSettings collects settings from GUI globals, only GUI thread may call it
+func currentSettings() conversionSettings {
+	return conversionSettings{
+		Resolution:      resToUse,
+		AudioCodec:      audioCodecToUse,
+		VideoCodec:      videoCodecToUse,
+		ContainerFormat: containerFormatToUse,
+		FilePrefix:      resultingFilePrefix,
+		OutputMode:      outputModeToUse,
+		AudioFormat:     audioFormatToUse,
+
+		CustomWidth:  customWidth,
+		CustomHeight: customHeight,
+		AspectMode:   aspectModeToUse,
+		NeverUpscale: neverUpscale,
+
+		FrameRate:                  frameRateToUse,
+		CustomFrameRate:            customFrameRate,
+		ForceConstantFrameRate:     forceConstantFrameRate,
+		NormalizeVariableFrameRate: normalizeVariableFrameRate,
+
+		AudioNormalize:      audioNormalize,
+		TargetLoudness:      targetLoudness,
+		TargetTruePeak:      targetTruePeak,
+		TargetLoudnessRange: targetLoudnessRange,
+		VolumeGain:          volumeGain,
+		AudioChannels:       audioChannelsToUse,
+		AudioSampleRate:     audioSampleRateToUse,
+
+		MetadataMode:     metadataModeToUse,
+		KeepChapters:     keepChapters,
+		KeepAttachments:  keepAttachments,
+		KeepCreationTime: keepCreationTime,
+		MetadataTitle:    metadataTitle,
+		MetadataArtist:   metadataArtist,
+		MetadataComment:  metadataComment,
+
+		ThumbnailPosition:   thumbnailPosition,
+		FrameCount:          frameCount,
+		ContactSheetColumns: contactSheetColumns,
+		ClipStart:           clipStart,
+		ClipDuration:        clipDuration,
+		ClipFps:             clipFps,
+		ClipWidth:           clipWidth,
+
+		Deinterlace:       deinterlaceToUse,
+		DeinterlaceFilter: deinterlaceFilterToUse,
+		Denoise:           denoiseToUse,
+		DenoiseStrength:   denoiseStrengthToUse,
+		Sharpen:           sharpen,
+		SharpenAmount:     sharpenAmount,
+		CropMode:          cropModeToUse,
+		CropTop:           cropTop,
+		CropBottom:        cropBottom,
+		CropLeft:          cropLeft,
+		CropRight:         cropRight,
+		Rotate:            rotateToUse,
+		FlipHorizontal:    flipHorizontal,
+		FlipVertical:      flipVertical,
+		PlaybackSpeed:     playbackSpeed,
+
+		WatermarkImage:    watermarkImage,
+		WatermarkPosition: watermarkPositionToUse,
+		WatermarkOpacity:  watermarkOpacity,
+		WatermarkScale:    watermarkScale,
+		OverlayText:       overlayText,
+		TextPosition:      textPositionToUse,
+		TextFont:          textFont,
+		TextSize:          textSize,
+		TextColor:         textColor,
+		TextBox:           textBox,
+		TextBoxColor:      textBoxColor,
+		OverlayMargin:     overlayMargin,
+
+		StreamingFormat:       streamingFormatToUse,
+		SegmentDuration:       segmentDuration,
+		StreamingAudioBitrate: streamingAudioBitrate,
+		StreamingLadder:       append([]ladderRung(nil), streamingLadder...),
+
+		DeleteLargerOutput:     deleteLargerOutput,
+		OriginalsAction:        originalsActionToUse,
+		OriginalsFolder:        originalsFolder,
+		OriginalsRenamePattern: originalsRenamePattern,
+		JobHook:                jobHookCommand,
+		RevealOutput:           revealOutput,
+		BatchHook:              batchHookCommand,
+
+		MatchingSource: matchingSourceToUse,
+		SkipCodec:      skipCodecToUse,
+
+		VerifyOutput:      verifyOutput,
+		FullDecodeCheck:   fullDecodeCheck,
+		DurationTolerance: durationTolerance,
+
+		QualityMetric: qualityMetricToUse,
+
+		RateControl:         rateControlToUse,
+		TargetQualityMetric: targetQualityMetricToUse,
+		TargetQualityScore:  targetQualityScore,
+		CrfSearchSamples:    crfSearchSamples,
+
+		PixelFormat: pixelFormatToUse,
+
+		WebOptimized: webOptimized,
+		H264Profile:  h264ProfileToUse,
+		H264Level:    h264LevelToUse,
+
+		HdrMode: hdrModeToUse,
+		Tonemap: tonemapToUse,
+
+		PreviewOffset:   previewOffset,
+		PreviewDuration: previewDuration,
+
+		AdvancedMode:        advancedMode,
+		AdvancedInputArgs:   advancedInputArgs,
+		AdvancedOutputArgs:  advancedOutputArgs,
+		AdvancedVideoFilter: advancedVideoFilter,
+		AdvancedAudioFilter: advancedAudioFilter,
+	}
+}
+
+// comboBoxValueOf returns value when it is an item of list, the first item otherwise
+func comboBoxValueOf(list []string, value string) string {
+	return list[comboBoxIndexOf(list, value)]
+}
+
+// withDefaults completes settings of a preset, history entry or older version: unset values are taken
+// from base, unknown choices fall back to the first item
+func (s conversionSettings) withDefaults(base conversionSettings) conversionSettings {
+	s.Resolution = comboBoxValueOf(resComboBoxLists, s.Resolution)
+	s.AudioCodec = comboBoxValueOf(audioCodecComboBoxLists, s.AudioCodec)
+	s.VideoCodec = comboBoxValueOf(videoCodecComboBoxLists, s.VideoCodec)
+	s.ContainerFormat = comboBoxValueOf(containerFormatComboBoxLists, s.ContainerFormat)
+	s.OutputMode = comboBoxValueOf(outputModeComboBoxLists, s.OutputMode)
+	s.AudioFormat = comboBoxValueOf(audioFormatComboBoxLists, s.AudioFormat)
+
+	if 0 == s.CustomWidth {
+		s.CustomWidth = base.CustomWidth
+	}
+	if 0 == s.CustomHeight {
+		s.CustomHeight = base.CustomHeight
+	}
+	s.AspectMode = comboBoxValueOf(aspectModeComboBoxLists, s.AspectMode)
+
+	s.FrameRate = comboBoxValueOf(frameRateComboBoxLists, s.FrameRate)
+	if 0 == s.CustomFrameRate {
+		s.CustomFrameRate = base.CustomFrameRate
+	}
+
+	if 0 == s.TargetLoudness {
+		s.TargetLoudness = base.TargetLoudness
+	}
+	if 0 == s.TargetTruePeak {
+		s.TargetTruePeak = base.TargetTruePeak
+	}
+	if 0 == s.TargetLoudnessRange {
+		s.TargetLoudnessRange = base.TargetLoudnessRange
+	}
+	s.AudioChannels = comboBoxValueOf(audioChannelsComboBoxLists, s.AudioChannels)
+	s.AudioSampleRate = comboBoxValueOf(audioSampleRateComboBoxLists, s.AudioSampleRate)
+
+	s.MetadataMode = comboBoxValueOf(metadataModeComboBoxLists, s.MetadataMode)
+
+	if "" == s.ThumbnailPosition {
+		s.ThumbnailPosition = base.ThumbnailPosition
+	}
+	if 0 == s.FrameCount {
+		s.FrameCount = base.FrameCount
+	}
+	if 0 == s.ContactSheetColumns {
+		s.ContactSheetColumns = base.ContactSheetColumns
+	}
+	if "" == s.ClipStart {
+		s.ClipStart = base.ClipStart
+	}
+	if 0 == s.ClipDuration {
+		s.ClipDuration = base.ClipDuration
+	}
+	if 0 == s.ClipFps {
+		s.ClipFps = base.ClipFps
+	}
+	if 0 == s.ClipWidth {
+		s.ClipWidth = base.ClipWidth
+	}
+
+	s.Deinterlace = comboBoxValueOf(deinterlaceComboBoxLists, s.Deinterlace)
+	s.DeinterlaceFilter = comboBoxValueOf(deinterlaceFilterComboBoxLists, s.DeinterlaceFilter)
+	s.Denoise = comboBoxValueOf(denoiseComboBoxLists, s.Denoise)
+	if "" == s.DenoiseStrength {
+		s.DenoiseStrength = "medium"
+	}
+	s.DenoiseStrength = comboBoxValueOf(denoiseStrengthComboBoxLists, s.DenoiseStrength)
+	if 0 == s.SharpenAmount {
+		s.SharpenAmount = base.SharpenAmount
+	}
+	s.CropMode = comboBoxValueOf(cropModeComboBoxLists, s.CropMode)
+	s.Rotate = comboBoxValueOf(rotateComboBoxLists, s.Rotate)
+	if 0 == s.PlaybackSpeed {
+		s.PlaybackSpeed = 1
+	}
+
+	s.WatermarkPosition = comboBoxValueOf(overlayPositionComboBoxLists, s.WatermarkPosition)
+	if 0 == s.WatermarkOpacity {
+		s.WatermarkOpacity = base.WatermarkOpacity
+	}
+	if 0 == s.WatermarkScale {
+		s.WatermarkScale = base.WatermarkScale
+	}
+	if "" == s.TextPosition {
+		s.TextPosition = "top left"
+	}
+	s.TextPosition = comboBoxValueOf(overlayPositionComboBoxLists, s.TextPosition)
+	if 0 == s.TextSize {
+		s.TextSize = base.TextSize
+	}
+	if "" == s.TextColor {
+		s.TextColor = base.TextColor
+	}
+	if "" == s.TextBoxColor {
+		s.TextBoxColor = base.TextBoxColor
+	}
+	if 0 == s.OverlayMargin {
+		s.OverlayMargin = base.OverlayMargin
+	}
+
+	if "" == s.StreamingFormat {
+		s.StreamingFormat = base.StreamingFormat
+	}
+	s.StreamingFormat = comboBoxValueOf(streamingFormatComboBoxLists, s.StreamingFormat)
+	if 0 == s.SegmentDuration {
+		s.SegmentDuration = base.SegmentDuration
+	}
+	if 0 == s.StreamingAudioBitrate {
+		s.StreamingAudioBitrate = base.StreamingAudioBitrate
+	}
+	if 0 == len(s.StreamingLadder) {
+		s.StreamingLadder = base.StreamingLadder
+	}
+	s.StreamingLadder = append([]ladderRung(nil), s.StreamingLadder...)
+
+	s.OriginalsAction = comboBoxValueOf(originalsActionComboBoxLists, s.OriginalsAction)
+	if "" == s.OriginalsFolder {
+		s.OriginalsFolder = base.OriginalsFolder
+	}
+	if "" == s.OriginalsRenamePattern {
+		s.OriginalsRenamePattern = base.OriginalsRenamePattern
+	}
+
+	s.MatchingSource = comboBoxValueOf(matchingSourceComboBoxLists, s.MatchingSource)
+	s.SkipCodec = comboBoxValueOf(skipCodecComboBoxLists, s.SkipCodec)
+
+	if 0 == s.DurationTolerance {
+		s.DurationTolerance = base.DurationTolerance
+	}
+
+	if _, ok := qualityMetricFilters[s.QualityMetric]; !ok {
+		s.QualityMetric = "none"
+	}
+
+	s.RateControl = comboBoxValueOf(rateControlComboBoxLists, s.RateControl)
+	if _, ok := targetQualityDefaults[s.TargetQualityMetric]; !ok {
+		s.TargetQualityMetric = "VMAF"
+	}
+	if 0 == s.TargetQualityScore {
+		s.TargetQualityScore = targetQualityDefaults[s.TargetQualityMetric]
+	}
+	if 0 == s.CrfSearchSamples {
+		s.CrfSearchSamples = base.CrfSearchSamples
+	}
+
+	s.PixelFormat = comboBoxValueOf(pixelFormatComboBoxLists, s.PixelFormat)
+
+	s.H264Profile = comboBoxValueOf(h264ProfileComboBoxLists, s.H264Profile)
+	s.H264Level = comboBoxValueOf(h264LevelComboBoxLists, s.H264Level)
+
+	s.HdrMode = comboBoxValueOf(hdrModeComboBoxLists, s.HdrMode)
+	s.Tonemap = comboBoxValueOf(tonemapComboBoxLists, s.Tonemap)
+
+	if "" == s.PreviewOffset {
+		s.PreviewOffset = base.PreviewOffset
+	}
+	if 0 == s.PreviewDuration {
+		s.PreviewDuration = base.PreviewDuration
+	}
+
+	return s
+}
+
+// applySettings restores GUI options from given snapshot, completed by current ones
+func applySettings(s conversionSettings) {
+	s = s.withDefaults(currentSettings())
+
+	resToUse = s.Resolution
+	resComboBoxIdx = comboBoxIndexOf(resComboBoxLists, resToUse)
+	audioCodecToUse = s.AudioCodec
+	audioCodecComboBoxIdx = comboBoxIndexOf(audioCodecComboBoxLists, audioCodecToUse)
+	videoCodecToUse = s.VideoCodec
+	videoCodecComboBoxIdx = comboBoxIndexOf(videoCodecComboBoxLists, videoCodecToUse)
+	containerFormatToUse = s.ContainerFormat
+	containerFormatComboBoxIdx = comboBoxIndexOf(containerFormatComboBoxLists, containerFormatToUse)
+	resultingFilePrefix = s.FilePrefix
+	outputModeToUse = s.OutputMode
+	outputModeComboBoxIdx = comboBoxIndexOf(outputModeComboBoxLists, outputModeToUse)
+	audioFormatToUse = s.AudioFormat
+	audioFormatComboBoxIdx = comboBoxIndexOf(audioFormatComboBoxLists, audioFormatToUse)
+
+	customWidth, customHeight = s.CustomWidth, s.CustomHeight
+	aspectModeToUse = s.AspectMode
+	aspectModeComboBoxIdx = comboBoxIndexOf(aspectModeComboBoxLists, aspectModeToUse)
+	neverUpscale = s.NeverUpscale
+
+	frameRateToUse = s.FrameRate
+	frameRateComboBoxIdx = comboBoxIndexOf(frameRateComboBoxLists, frameRateToUse)
+	customFrameRate = s.CustomFrameRate
+	forceConstantFrameRate = s.ForceConstantFrameRate
+	normalizeVariableFrameRate = s.NormalizeVariableFrameRate
+
+	audioNormalize = s.AudioNormalize
+	targetLoudness = s.TargetLoudness
+	targetTruePeak = s.TargetTruePeak
+	targetLoudnessRange = s.TargetLoudnessRange
+	volumeGain = s.VolumeGain
+	audioChannelsToUse = s.AudioChannels
+	audioChannelsComboBoxIdx = comboBoxIndexOf(audioChannelsComboBoxLists, audioChannelsToUse)
+	audioSampleRateToUse = s.AudioSampleRate
+	audioSampleRateComboBoxIdx = comboBoxIndexOf(audioSampleRateComboBoxLists, audioSampleRateToUse)
+
+	metadataModeToUse = s.MetadataMode
+	metadataModeComboBoxIdx = comboBoxIndexOf(metadataModeComboBoxLists, metadataModeToUse)
+	keepChapters = s.KeepChapters
+	keepAttachments = s.KeepAttachments
+	keepCreationTime = s.KeepCreationTime
+	metadataTitle = s.MetadataTitle
+	metadataArtist = s.MetadataArtist
+	metadataComment = s.MetadataComment
+
+	thumbnailPosition = s.ThumbnailPosition
+	frameCount = s.FrameCount
+	contactSheetColumns = s.ContactSheetColumns
+	clipStart = s.ClipStart
+	clipDuration = s.ClipDuration
+	clipFps = s.ClipFps
+	clipWidth = s.ClipWidth
+
+	deinterlaceToUse = s.Deinterlace
+	deinterlaceComboBoxIdx = comboBoxIndexOf(deinterlaceComboBoxLists, deinterlaceToUse)
+	deinterlaceFilterToUse = s.DeinterlaceFilter
+	deinterlaceFilterComboBoxIdx = comboBoxIndexOf(deinterlaceFilterComboBoxLists, deinterlaceFilterToUse)
+	denoiseToUse = s.Denoise
+	denoiseComboBoxIdx = comboBoxIndexOf(denoiseComboBoxLists, denoiseToUse)
+	denoiseStrengthToUse = s.DenoiseStrength
+	denoiseStrengthComboBoxIdx = comboBoxIndexOf(denoiseStrengthComboBoxLists, denoiseStrengthToUse)
+	sharpen = s.Sharpen
+	sharpenAmount = s.SharpenAmount
+	cropModeToUse = s.CropMode
+	cropModeComboBoxIdx = comboBoxIndexOf(cropModeComboBoxLists, cropModeToUse)
+	cropTop, cropBottom, cropLeft, cropRight = s.CropTop, s.CropBottom, s.CropLeft, s.CropRight
+	rotateToUse = s.Rotate
+	rotateComboBoxIdx = comboBoxIndexOf(rotateComboBoxLists, rotateToUse)
+	flipHorizontal = s.FlipHorizontal
+	flipVertical = s.FlipVertical
+	playbackSpeed = s.PlaybackSpeed
+
+	watermarkImage = s.WatermarkImage
+	watermarkPositionToUse = s.WatermarkPosition
+	watermarkPositionComboBoxIdx = comboBoxIndexOf(overlayPositionComboBoxLists, watermarkPositionToUse)
+	watermarkOpacity = s.WatermarkOpacity
+	watermarkScale = s.WatermarkScale
+	overlayText = s.OverlayText
+	textPositionToUse = s.TextPosition
+	textPositionComboBoxIdx = comboBoxIndexOf(overlayPositionComboBoxLists, textPositionToUse)
+	textFont = s.TextFont
+	textSize = s.TextSize
+	textColor = s.TextColor
+	textBox = s.TextBox
+	textBoxColor = s.TextBoxColor
+	overlayMargin = s.OverlayMargin
+
+	streamingFormatToUse = s.StreamingFormat
+	streamingFormatComboBoxIdx = comboBoxIndexOf(streamingFormatComboBoxLists, streamingFormatToUse)
+	segmentDuration = s.SegmentDuration
+	streamingAudioBitrate = s.StreamingAudioBitrate
+	streamingLadder = s.StreamingLadder
+
+	deleteLargerOutput = s.DeleteLargerOutput
+	originalsActionToUse = s.OriginalsAction
+	originalsActionComboBoxIdx = comboBoxIndexOf(originalsActionComboBoxLists, originalsActionToUse)
+	originalsFolder = s.OriginalsFolder
+	originalsRenamePattern = s.OriginalsRenamePattern
+	jobHookCommand = s.JobHook
+	revealOutput = s.RevealOutput
+	batchHookCommand = s.BatchHook
+
+	matchingSourceToUse = s.MatchingSource
+	matchingSourceComboBoxIdx = comboBoxIndexOf(matchingSourceComboBoxLists, matchingSourceToUse)
+	skipCodecToUse = s.SkipCodec
+	skipCodecComboBoxIdx = comboBoxIndexOf(skipCodecComboBoxLists, skipCodecToUse)
+
+	verifyOutput = s.VerifyOutput
+	fullDecodeCheck = s.FullDecodeCheck
+	durationTolerance = s.DurationTolerance
+
+	qualityMetricToUse = s.QualityMetric
+
+	rateControlToUse = s.RateControl
+	rateControlComboBoxIdx = comboBoxIndexOf(rateControlComboBoxLists, rateControlToUse)
+	targetQualityMetricToUse = s.TargetQualityMetric
+	targetQualityScore = s.TargetQualityScore
+	crfSearchSamples = s.CrfSearchSamples
+
+	pixelFormatToUse = s.PixelFormat
+	pixelFormatComboBoxIdx = comboBoxIndexOf(pixelFormatComboBoxLists, pixelFormatToUse)
+
+	webOptimized = s.WebOptimized
+	h264ProfileToUse = s.H264Profile
+	h264ProfileComboBoxIdx = comboBoxIndexOf(h264ProfileComboBoxLists, h264ProfileToUse)
+	h264LevelToUse = s.H264Level
+	h264LevelComboBoxIdx = comboBoxIndexOf(h264LevelComboBoxLists, h264LevelToUse)
+
+	hdrModeToUse = s.HdrMode
+	hdrModeComboBoxIdx = comboBoxIndexOf(hdrModeComboBoxLists, hdrModeToUse)
+	tonemapToUse = s.Tonemap
+	tonemapComboBoxIdx = comboBoxIndexOf(tonemapComboBoxLists, tonemapToUse)
+
+	previewOffset = s.PreviewOffset
+	previewDuration = s.PreviewDuration
+
+	advancedMode = s.AdvancedMode
+	advancedInputArgs = s.AdvancedInputArgs
+	advancedOutputArgs = s.AdvancedOutputArgs
+	advancedVideoFilter = s.AdvancedVideoFilter
+	advancedAudioFilter = s.AdvancedAudioFilter
+}
+
+func comboBoxIndexOf(list []string, value string) int32 {
+	for i, item := range list {
+		if item == value {
+			return int32(i)
+		}
+	}
+
+	return 0
+}
+
+func ffmpegOutputKwargs(s conversionSettings) ffmpeg.KwArgs {
 	args := ffmpeg.KwArgs{
 		"c:a": "copy",
 		"c:v": "copy",
 	}
 
-	switch audioCodecToUse {
+	switch s.AudioCodec {
 	case "AAC":
 		args["c:a"] = "aac"
 	case "OPUS":
@@ -100,22 +689,13 @@ func ffmpegOutputKwargs() ffmpeg.KwArgs {
 		args["c:a"] = "libvorbis"
 	}
 
-	switch videoCodecToUse {
+	switch s.VideoCodec {
 	case "H.264":
 		args["c:v"] = "libx264"
 	case "H.265":
 		args["c:v"] = "libx265"
 	}
 
-	switch resToUse {
-	case "480p":
-		args["filter:v"] = "scale=trunc(oh*a/2)*2:480"
-	case "720p":
-		args["filter:v"] = "scale=trunc(oh*a/2)*2:720"
-	case "1080p":
-		args["filter:v"] = "scale=trunc(oh*a/2)*2:1080"
-	}
-
 	return args
 }
 
@@ -231,6 +811,7 @@ type ffprobeOutput struct {
 		ColorTransfer      string `json:"color_transfer,omitempty"`
 		ColorPrimaries     string `json:"color_primaries,omitempty"`
 		ChromaLocation     string `json:"chroma_location,omitempty"`
+		FieldOrder         string `json:"field_order,omitempty"`
 		Refs               int    `json:"refs,omitempty"`
 		IsAvc              string `json:"is_avc,omitempty"`
 		NalLengthSize      string `json:"nal_length_size,omitempty"`
@@ -244,7 +825,23 @@ type ffprobeOutput struct {
 		BitRate            string `json:"bit_rate"`
 		BitsPerRawSample   string `json:"bits_per_raw_sample,omitempty"`
 		NbFrames           string `json:"nb_frames"`
-		Disposition        struct {
+		SideDataList       []struct {
+			SideDataType string `json:"side_data_type"`
+			Rotation     int    `json:"rotation,omitempty"`
+			RedX         string `json:"red_x,omitempty"`
+			RedY         string `json:"red_y,omitempty"`
+			GreenX       string `json:"green_x,omitempty"`
+			GreenY       string `json:"green_y,omitempty"`
+			BlueX        string `json:"blue_x,omitempty"`
+			BlueY        string `json:"blue_y,omitempty"`
+			WhitePointX  string `json:"white_point_x,omitempty"`
+			WhitePointY  string `json:"white_point_y,omitempty"`
+			MinLuminance string `json:"min_luminance,omitempty"`
+			MaxLuminance string `json:"max_luminance,omitempty"`
+			MaxContent   int    `json:"max_content,omitempty"`
+			MaxAverage   int    `json:"max_average,omitempty"`
+		} `json:"side_data_list,omitempty"`
+		Disposition struct {
 			Default         int `json:"default"`
 			Dub             int `json:"dub"`
 			Original        int `json:"original"`
@@ -259,9 +856,13 @@ type ffprobeOutput struct {
 			TimedThumbnails int `json:"timed_thumbnails"`
 		} `json:"disposition"`
 		Tags struct {
-			Language    string `json:"language"`
-			HandlerName string `json:"handler_name"`
-			VendorID    string `json:"vendor_id"`
+			Rotate       string `json:"rotate,omitempty"`
+			Language     string `json:"language"`
+			HandlerName  string `json:"handler_name"`
+			VendorID     string `json:"vendor_id"`
+			CreationTime string `json:"creation_time,omitempty"`
+			Filename     string `json:"filename,omitempty"`
+			Mimetype     string `json:"mimetype,omitempty"`
 		} `json:"tags"`
 		SampleFmt     string `json:"sample_fmt,omitempty"`
 		SampleRate    string `json:"sample_rate,omitempty"`
@@ -285,13 +886,28 @@ type ffprobeOutput struct {
 			MinorVersion     string `json:"minor_version"`
 			CompatibleBrands string `json:"compatible_brands"`
 			Encoder          string `json:"encoder"`
+			CreationTime     string `json:"creation_time,omitempty"`
+			Title            string `json:"title,omitempty"`
+			Artist           string `json:"artist,omitempty"`
+			Comment          string `json:"comment,omitempty"`
+			Location         string `json:"location,omitempty"`
+			LocationEng      string `json:"location-eng,omitempty"`
+			LocationISO6709  string `json:"com.apple.quicktime.location.ISO6709,omitempty"`
 		} `json:"tags"`
 	} `json:"format"`
+	Chapters []struct {
+		ID        int    `json:"id"`
+		StartTime string `json:"start_time"`
+		EndTime   string `json:"end_time"`
+		Tags      struct {
+			Title string `json:"title"`
+		} `json:"tags"`
+	} `json:"chapters"`
 }
 
 func detectWithFfprobe(filename string) (ffprobeOutput, error) {
 	var ret ffprobeOutput
-	probeOutputString, err := ffmpeg.Probe(filename)
+	probeOutputString, err := ffmpeg.Probe(filename, ffmpeg.KwArgs{"show_chapters": ""})
 	if nil != err {
 		return ret, err
 	}
@@ -319,75 +935,306 @@ func detectFileMimetype(filename string) (string, error) {
 }
 
 func onClickConvert() {
-	go convertVideo()
+	go convertVideo(currentSettings(), append([]string(nil), listOfVideos...))
 }
 
 func onClickCancel() {
-	ffmpegCancelChannel <- struct{}{}
+	cancelRunningJob()
 }
 
-func convertVideo() {
-	var wg sync.WaitGroup
+// runFfmpegCmd runs given ffmpeg command until it finishes or is cancelled, then returns history result and message
+func runFfmpegCmd(ffmpegCmd *exec.Cmd, convertedPath string) (string, string) {
+	var cancelled int32
 
-	for _, videoFilename := range listOfVideos {
-		wg.Add(1)
-		isConversionPreparing = true
-		convertingHelperMsg = ""
+	isCurrentlyConverting = true
+	ffmpegFinishChannel := make(chan struct{})
 
-		go func(videoPath string, wg *sync.WaitGroup) {
-			dirname := filepath.Dir(videoPath)
-			filename := filepath.Base(videoPath)
-			fileext := filepath.Ext(videoPath)
-			filenameWithoutExt := strings.TrimRight(filename, fileext)
+	go func() {
+		select {
+		case <-ffmpegCancelChannel:
+			atomic.StoreInt32(&cancelled, 1)
+			isConversionPreparing = false
+			isCurrentlyConverting = false
+			ffmpegCmd.Process.Kill()
+		case <-ffmpegFinishChannel:
+			break
+		}
+	}()
 
-			fileprefix := resultingFilePrefix
-			if "original" != resToUse {
-				fileprefix += fmt.Sprintf("%s-", resToUse)
-			}
+	result, message := historyResultSuccess, ""
+	if err := ffmpegCmd.Run(); nil != err {
+		convertingHelperMsg = err.Error()
+		result, message = historyResultFailed, err.Error()
+		if 1 == atomic.LoadInt32(&cancelled) {
+			result = historyResultCancelled
+		}
+	} else {
+		convertingHelperMsg = fmt.Sprintf("finish conversion\ndestination:\n %s", convertedPath)
+	}
 
-			switch containerFormatToUse {
-			case "mp4":
-				fileext = ".mp4"
-			case "mkv":
-				fileext = ".mkv"
-			}
+	close(ffmpegFinishChannel)
+	isConversionPreparing = false
+	isCurrentlyConverting = false
+	convertingFFmpegOutput.Reset()
 
-			convertedPath := fmt.Sprintf("%s/%s%s%s", dirname, fileprefix, filenameWithoutExt, fileext)
-			convertingHelperMsg = fmt.Sprintf("currently converting:\n %s\ndestination:\n %s", videoPath, convertedPath)
-
-			isCurrentlyConverting = true
-			ffmpegCmd := ffmpeg.Input(videoPath).Output(convertedPath, ffmpegOutputKwargs()).OverWriteOutput().WithErrorOutput(&convertingFFmpegOutput).Compile()
-			ffmpegFinishChannel := make(chan struct{})
-
-			go func() {
-				select {
-				case <-ffmpegCancelChannel:
-					isConversionPreparing = false
-					isCurrentlyConverting = false
-					ffmpegCmd.Process.Kill()
-				case <-ffmpegFinishChannel:
-					break
-				}
-			}()
+	return result, message
+}
 
-			if err := ffmpegCmd.Run(); nil != err {
-				convertingHelperMsg = err.Error()
-			} else {
-				convertingHelperMsg = fmt.Sprintf("finish conversion\ndestination:\n %s", convertedPath)
-			}
+// convertSingleVideo runs every step of conversion for one video, then records it on history.
+// ffmpeg output of the conversion is copied into progress as well, if given.
+func convertSingleVideo(s conversionSettings, videoPath string, progress io.Writer) (entry historyEntry) {
+	convertedPath := convertedPathFor(s, videoPath)
+	convertingHelperMsg = fmt.Sprintf("currently converting:\n %s\ndestination:\n %s", videoPath, convertedPath)
+
+	entry = historyEntry{
+		InputPath:  videoPath,
+		OutputPath: convertedPath,
+		Settings:   s,
+		StartedAt:  time.Now(),
+	}
 
-			close(ffmpegFinishChannel)
-			isConversionPreparing = false
-			isCurrentlyConverting = false
-			convertingFFmpegOutput.Reset()
+	defer func() {
+		entry.FinishedAt = time.Now()
+		if err := appendHistory(entry); nil != err {
+			convertingHelperMsg += fmt.Sprintf("\nfailed to save history: %s", err)
+		}
+	}()
+
+	plan, reason := sourcePlan(s, videoPath)
+	if planSkip == plan {
+		convertingHelperMsg = fmt.Sprintf("skipped (%s):\n %s", reason, videoPath)
+		entry.Result, entry.Message = historyResultSkipped, reason
+		return
+	}
+
+	// options are checked before slow passes, so that e.g. loudness filter on copied audio fails without measuring first
+	if _, _, _, err := ffmpegKwargs(s, videoPath, convertedPath); nil != err {
+		convertingHelperMsg = err.Error()
+		entry.Result, entry.Message = historyResultFailed, err.Error()
+		return
+	}
+
+	if s.AudioNormalize && !isImageOutputMode(s) {
+		convertingHelperMsg = fmt.Sprintf("measuring loudness:\n %s", videoPath)
+
+		measurement, result, message := measureLoudness(s, videoPath)
+		if historyResultSuccess != result {
+			entry.Result, entry.Message = result, fmt.Sprintf("loudness measurement: %s", message)
+			return
+		}
 
-			// deliberate sleep before finish
-			time.Sleep(3 * time.Second)
-			wg.Done()
-		}(videoFilename, &wg)
+		setLoudnormMeasurement(videoPath, measurement)
+		entry.Loudness = &measurement
+		convertingHelperMsg = fmt.Sprintf("currently converting (measured %s LUFS):\n %s\ndestination:\n %s", measurement.InputI, videoPath, convertedPath)
+	}
+
+	forgetDetectedCrop(videoPath)
+	if isAutoCrop(s) {
+		convertingHelperMsg = fmt.Sprintf("detecting crop:\n %s", videoPath)
+
+		area, result, message := detectCrop(videoPath)
+		if historyResultSuccess != result {
+			entry.Result, entry.Message = result, fmt.Sprintf("crop detection: %s", message)
+			return
+		}
+
+		setDetectedCrop(videoPath, area)
+		entry.Crop = &area
+	}
 
-		wg.Wait()
+	forgetSearchedCrf(videoPath)
+	if isCrfSearchable(s, videoPath) {
+		search, result, message := searchCrf(s, videoPath)
+		entry.CrfSearch = &search
+		if historyResultSuccess != result {
+			entry.Result, entry.Message = result, fmt.Sprintf("crf search: %s", message)
+			return
+		}
+
+		setSearchedCrf(videoPath, search.Crf)
+		convertingHelperMsg = fmt.Sprintf("currently converting (%s):\n %s\ndestination:\n %s", search, videoPath, convertedPath)
+	}
+
+	// output is written under temporary name, so that a crash never leaves partial file under final name
+	writePath := convertedPath
+	if partialPath := partialPathFor(s, convertedPath); "" != partialPath {
+		writePath = partialPath
+	}
+
+	ffmpegCmd, err := compileFfmpegCmd(s, videoPath, writePath)
+	if nil != err {
+		convertingHelperMsg = err.Error()
+		entry.Result, entry.Message = historyResultFailed, err.Error()
+		return
 	}
+
+	if isStreamingOutputMode(s) {
+		if err := prepareStreamingOutput(convertedPath); nil != err {
+			convertingHelperMsg = err.Error()
+			entry.Result, entry.Message = historyResultFailed, err.Error()
+			return
+		}
+	}
+
+	if nil != progress {
+		ffmpegCmd.Stderr = io.MultiWriter(ffmpegCmd.Stderr, progress)
+	}
+
+	// history keeps command writing final output, partial file is renamed by this function only
+	entry.Args, _ = ffmpegArgs(s, videoPath, convertedPath)
+	entry.Result, entry.Message = runFfmpegCmd(ffmpegCmd, convertedPath)
+	if writePath != convertedPath {
+		if err := finishPartialOutput(writePath, convertedPath, entry.Result); nil != err {
+			convertingHelperMsg = err.Error()
+			entry.Result, entry.Message = historyResultFailed, err.Error()
+			return
+		}
+	}
+	if planRemux == plan && historyResultSuccess == entry.Result {
+		entry.Message = fmt.Sprintf("remuxed: %s", reason)
+	}
+
+	if s.VerifyOutput && historyResultSuccess == entry.Result && isVerifiableOutput(s, convertedPath) {
+		convertingHelperMsg = fmt.Sprintf("verifying:\n %s", convertedPath)
+
+		verification, result, message := verifyConversion(s, videoPath, convertedPath)
+		entry.Verification = &verification
+		if historyResultSuccess != result {
+			entry.Result, entry.Message = result, fmt.Sprintf("verification: %s", message)
+			return
+		}
+
+		if verification.Passed {
+			convertingHelperMsg = fmt.Sprintf("finish conversion (verified)\ndestination:\n %s", convertedPath)
+		} else {
+			entry.Result, entry.Message = historyResultFailed, fmt.Sprintf("verification failed: %s", strings.Join(verification.Problems, "; "))
+			convertingHelperMsg = entry.Message
+		}
+	}
+
+	if "none" != s.QualityMetric && historyResultSuccess == entry.Result && isQualityAnalyzable(s, convertedPath) {
+		convertingHelperMsg = fmt.Sprintf("analyzing quality (%s):\n %s", s.QualityMetric, convertedPath)
+
+		// output is fine even when analysis fails, so it does not fail the job
+		score, result, message := analyzeQuality(s, s.QualityMetric, videoPath, convertedPath)
+		if historyResultSuccess == result {
+			entry.Quality = &score
+			convertingHelperMsg = fmt.Sprintf("finish conversion (%s)\ndestination:\n %s", score, convertedPath)
+		} else {
+			entry.Message = strings.TrimSpace(fmt.Sprintf("%s quality analysis %s: %s", entry.Message, result, message))
+			convertingHelperMsg = entry.Message
+		}
+	}
+
+	return entry
+}
+
+// convertVideo queues videos with settings, on the same queue as API jobs
+func convertVideo(settings conversionSettings, videos []string) {
+	if err := savePreferences(settings); nil != err {
+		convertingHelperMsg = fmt.Sprintf("failed to save preferences: %s", err)
+	}
+
+	batchID := newBatchID()
+	defer closeBatch(batchID)
+
+	for _, videoPath := range videos {
+		probe, _ := videoProbeOf(videoPath)
+		if _, err := submitJob(videoPath, probe, settings, "", batchID); nil != err {
+			convertingHelperMsg = err.Error()
+			return
+		}
+	}
+}
+
+// videoLayouts returns widgets of options only meaningful when output has video
+func videoLayouts() []g.Widget {
+	var widgets []g.Widget
+
+	widgets = append(widgets, []g.Widget{
+		g.Row(
+			g.Label("resolution"),
+			g.Dummy(10, 0),
+			g.Combo("", resComboBoxLists[resComboBoxIdx], resComboBoxLists, &resComboBoxIdx).OnChange(func() {
+				resToUse = resComboBoxLists[resComboBoxIdx]
+			}),
+		),
+	}...)
+
+	widgets = append(widgets, resolutionLayouts()...)
+	widgets = append(widgets, frameRateLayouts()...)
+	widgets = append(widgets, filtersLayouts()...)
+	widgets = append(widgets, overlayLayouts()...)
+
+	widgets = append(widgets, []g.Widget{
+		g.Row(
+			g.Label("audio codec"),
+			g.Dummy(10, 0),
+			g.Combo("", audioCodecComboBoxLists[audioCodecComboBoxIdx], audioCodecComboBoxLists, &audioCodecComboBoxIdx).OnChange(func() {
+				audioCodecToUse = audioCodecComboBoxLists[audioCodecComboBoxIdx]
+			}),
+		),
+		g.Row(
+			g.Label("video codec"),
+			g.Dummy(10, 0),
+			g.Combo("", videoCodecComboBoxLists[videoCodecComboBoxIdx], videoCodecComboBoxLists, &videoCodecComboBoxIdx).OnChange(func() {
+				videoCodecToUse = videoCodecComboBoxLists[videoCodecComboBoxIdx]
+			}),
+		),
+	}...)
+
+	widgets = append(widgets, rateControlLayouts()...)
+	widgets = append(widgets, pixelFormatLayouts()...)
+	widgets = append(widgets, hdrLayouts()...)
+
+	widgets = append(widgets, []g.Widget{
+		g.Row(
+			g.Label("container"),
+			g.Dummy(10, 0),
+			g.Combo("", containerFormatComboBoxLists[containerFormatComboBoxIdx], containerFormatComboBoxLists, &containerFormatComboBoxIdx).OnChange(func() {
+				containerFormatToUse = containerFormatComboBoxLists[containerFormatComboBoxIdx]
+			}),
+		),
+	}...)
+
+	widgets = append(widgets, webLayouts()...)
+	widgets = append(widgets, smartLayouts()...)
+
+	return widgets
+}
+
+// convertListStatus is what main layout shows about convert list. Building ffmpeg options of every video
+// and querying free space is too heavy for every frame, so it is kept until settings or list change.
+type convertListStatus struct {
+	key            string
+	updatedAt      time.Time
+	commandPreview string
+	warnings       []string
+	err            error
+	sizeLabel      string
+}
+
+var lastConvertListStatus convertListStatus
+
+// convertListStatusOf returns status of list with s, rebuilt when settings or list change,
+// and at least once a second since free space and probes change by themselves
+func convertListStatusOf(s conversionSettings) convertListStatus {
+	data, _ := json.Marshal(s)
+	key := string(data) + "\n" + strings.Join(listOfVideos, "\n")
+	if key == lastConvertListStatus.key && time.Second > time.Since(lastConvertListStatus.updatedAt) {
+		return lastConvertListStatus
+	}
+
+	status := convertListStatus{
+		key:            key,
+		updatedAt:      time.Now(),
+		commandPreview: ffmpegCommandPreview(s),
+		sizeLabel:      estimatedSizeLabel(s),
+	}
+	status.warnings, status.err = ffmpegKwargsStatus(s)
+	lastConvertListStatus = status
+
+	return status
 }
 
 func myLayouts() []g.Widget {
@@ -418,9 +1265,21 @@ func myLayouts() []g.Widget {
 		return widgets
 	}
 
+	if showHistory {
+		return append(widgets, historyLayouts()...)
+	}
+
+	widgets = append(widgets, g.Row(
+		g.Button("History").OnClick(func() {
+			showHistory = true
+		}),
+		g.Label(apiHelperMsg),
+	))
+	widgets = append(widgets, recoveryLayouts()...)
+
 	if 0 == len(listOfVideos) {
 		widgets = append(widgets, []g.Widget{
-			g.Dummy(0, 180),
+			g.Dummy(0, 150),
 			g.Style().SetFontSize(20).To(
 				g.Align(g.AlignCenter).To(g.Label("Drag and Drop your video files here!")),
 			),
@@ -428,6 +1287,11 @@ func myLayouts() []g.Widget {
 			g.Dummy(0, 180),
 		}...)
 	} else {
+		settings := currentSettings()
+		status := convertListStatusOf(settings)
+		commandPreview := status.commandPreview
+		kwargsWarnings, kwargsErr := status.warnings, status.err
+
 		widgets = append(widgets, []g.Widget{
 			g.Dummy(0, 15),
 			g.Label("Convert List"),
@@ -435,43 +1299,73 @@ func myLayouts() []g.Widget {
 				g.Dummy(10, 0),
 				g.Label(strings.Join(listOfVideos, "\n")).Wrapped(true),
 			),
+			g.Label(status.sizeLabel).Wrapped(true),
 			g.Dummy(0, 10),
 			g.Row(
-				g.Label("resolution"),
+				g.Label("mode"),
 				g.Dummy(10, 0),
-				g.Combo("", resComboBoxLists[resComboBoxIdx], resComboBoxLists, &resComboBoxIdx).OnChange(func() {
-					resToUse = resComboBoxLists[resComboBoxIdx]
+				g.Combo("##outputmode", outputModeComboBoxLists[outputModeComboBoxIdx], outputModeComboBoxLists, &outputModeComboBoxIdx).OnChange(func() {
+					outputModeToUse = outputModeComboBoxLists[outputModeComboBoxIdx]
 				}),
 			),
+		}...)
+
+		switch {
+		case isImageOutputMode(settings):
+			widgets = append(widgets, imageLayouts()...)
+		case isStreamingOutputMode(settings):
+			widgets = append(widgets, streamingLayouts()...)
+		case "extract audio" == outputModeToUse:
+			widgets = append(widgets, extractAudioLayouts()...)
+		default:
+			widgets = append(widgets, videoLayouts()...)
+		}
+
+		widgets = append(widgets, []g.Widget{
 			g.Row(
 				g.Label("prefix"),
 				g.Dummy(10, 0),
 				g.InputText(&resultingFilePrefix),
 			),
-			g.Row(
-				g.Label("audio codec"),
-				g.Dummy(10, 0),
-				g.Combo("", audioCodecComboBoxLists[audioCodecComboBoxIdx], audioCodecComboBoxLists, &audioCodecComboBoxIdx).OnChange(func() {
-					audioCodecToUse = audioCodecComboBoxLists[audioCodecComboBoxIdx]
-				}),
-			),
-			g.Row(
-				g.Label("video codec"),
-				g.Dummy(10, 0),
-				g.Combo("", videoCodecComboBoxLists[videoCodecComboBoxIdx], videoCodecComboBoxLists, &videoCodecComboBoxIdx).OnChange(func() {
-					videoCodecToUse = videoCodecComboBoxLists[videoCodecComboBoxIdx]
-				}),
-			),
-			g.Row(
-				g.Label("container"),
-				g.Dummy(10, 0),
-				g.Combo("", containerFormatComboBoxLists[containerFormatComboBoxIdx], containerFormatComboBoxLists, &containerFormatComboBoxIdx).OnChange(func() {
-					containerFormatToUse = containerFormatComboBoxLists[containerFormatComboBoxIdx]
+		}...)
+
+		if !isImageOutputMode(settings) {
+			widgets = append(widgets, audioLayouts()...)
+			if !isStreamingOutputMode(settings) {
+				widgets = append(widgets, metadataLayouts()...)
+			}
+		}
+		if !isImageOutputMode(settings) && !isStreamingOutputMode(settings) {
+			widgets = append(widgets, verifyLayouts()...)
+		}
+		if "convert video" == outputModeToUse {
+			widgets = append(widgets, qualityLayouts()...)
+		}
+		widgets = append(widgets, actionsLayouts()...)
+		widgets = append(widgets, advancedLayouts()...)
+		widgets = append(widgets, presetLayouts()...)
+		widgets = append(widgets, previewLayouts()...)
+
+		widgets = append(widgets, []g.Widget{
+			g.TreeNode("show command").Layout(
+				g.Label(commandPreview).Wrapped(true),
+				g.Button("Copy command").OnClick(func() {
+					g.Context.GetPlatform().SetClipboard(commandPreview)
 				}),
 			),
+		}...)
+
+		if nil != kwargsErr {
+			widgets = append(widgets, g.Label(fmt.Sprintf("error: %s", kwargsErr)).Wrapped(true))
+		}
+		for _, warning := range kwargsWarnings {
+			widgets = append(widgets, g.Label(fmt.Sprintf("warning: %s", warning)).Wrapped(true))
+		}
+
+		widgets = append(widgets, []g.Widget{
 			g.Dummy(0, 10),
 			g.Row(
-				g.Button("Execute").OnClick(onClickConvert).Disabled(isCurrentlyConverting),
+				g.Button("Execute").OnClick(onClickConvert).Disabled(isCurrentlyConverting || nil != kwargsErr),
 				g.Button("Cancel").OnClick(onClickCancel).Disabled(!isCurrentlyConverting),
 			),
 
@@ -479,6 +1373,9 @@ func myLayouts() []g.Widget {
 			g.Dummy(0, 10),
 		}...)
 
+		widgets = append(widgets, settingsStoreLayouts()...)
+		widgets = append(widgets, diskSpaceLayouts()...)
+
 		if isCurrentlyConverting {
 			outputString := convertingFFmpegOutput.String()
 			substring := ""
@@ -502,21 +1399,93 @@ func myLayouts() []g.Widget {
 }
 
 func loop() {
+	publishSettings(currentSettings())
+
 	g.SingleWindow().Layout(
 		myLayouts()...,
 	)
 }
 
-func main() {
-	go func() {
+// prepareFfmpeg finds ffmpeg and ffprobe, downloading them when not found
+func prepareFfmpeg() {
+	checkFfmpegAndFfprobe()
+	if !isFfmpegReady {
+		updateEnvPath()
 		checkFfmpegAndFfprobe()
-		if !isFfmpegReady {
-			updateEnvPath()
-			checkFfmpegAndFfprobe()
-			downloadFfmpegAndFfprobe()
-			checkFfmpegAndFfprobe()
+		downloadFfmpegAndFfprobe()
+		checkFfmpegAndFfprobe()
+	}
+
+	if isFfmpegReady {
+		probeFfmpegFilters()
+	}
+}
+
+func main() {
+	settingsStoreErr = openSettingsStore()
+
+	if dryRun, filenames := parseCommandLine(os.Args[1:]); dryRun {
+		printDryRun(currentSettings(), os.Stdout, filenames)
+		return
+	}
+
+	if resetSettings && nil != settingsStoreErr {
+		if err := resetSettingsStore(); nil != err {
+			fmt.Fprintf(os.Stderr, "failed to reset settings: %s\n", err)
+			os.Exit(1)
 		}
-	}()
+	}
+	if nil != settingsStoreErr && headless {
+		fmt.Fprintf(os.Stderr, "%s\nrun with --reset-settings to start with empty settings\n", settingsStoreErr)
+	}
+
+	if saveToken {
+		if err := saveAPIToken(apiToken); nil != err {
+			fmt.Fprintf(os.Stderr, "failed to save token: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if "" == apiToken {
+		apiToken = storedAPIToken()
+	}
+
+	if err := loadHistory(); nil != err {
+		convertingHelperMsg = fmt.Sprintf("failed to load history: %s", err)
+	}
+
+	if err := loadPresets(); nil != err {
+		presetHelperMsg = fmt.Sprintf("failed to load presets: %s", err)
+	}
+
+	if err := loadQueue(); nil != err {
+		recoveryHelperMsg = fmt.Sprintf("failed to load queue: %s", err)
+	}
+
+	// settings never change without GUI, so this is the only copy headless API reads
+	publishSettings(currentSettings())
+
+	if serveAPI {
+		if err := startAPIServer(); nil != err {
+			if headless {
+				fmt.Fprintf(os.Stderr, "failed to start api: %s\n", err)
+				os.Exit(1)
+			}
+			apiHelperMsg = fmt.Sprintf("failed to start api: %s", err)
+		}
+	}
+
+	if headless {
+		fmt.Println(apiHelperMsg)
+		prepareFfmpeg()
+		// nobody is there to decide, so unfinished jobs are resumed right away
+		if 0 < len(recoveredJobs) {
+			resumeRecoveredJobs()
+			fmt.Println(recoveryHelperMsg)
+		}
+		select {}
+	}
+
+	go prepareFfmpeg()
 
 	wnd := g.NewMasterWindow(fmt.Sprintf("video converter - %s", VERSION), 400, 400, g.MasterWindowFlagsNotResizable)
 
@@ -525,6 +1494,7 @@ func main() {
 			return
 		}
 
+		// probes of previous list are kept, queued jobs may still be using them
 		if 0 < len(listOfVideos) {
 			listOfVideos = []string{}
 		}
@@ -538,16 +1508,14 @@ func main() {
 
 				filename = norm.NFC.String(filename)
 
-				// TODO
-				// if ffprobeOutput, err := detectWithFfprobe(filename); nil == err {
-				if _, err := detectWithFfprobe(filename); nil == err {
+				if ffprobeOutput, err := detectWithFfprobe(filename); nil == err {
 					listOfVideos = append(listOfVideos, filename)
-					// for _, ffprobeOutputStream := range ffprobeOutput.Streams {
-					// 	codecName := ffprobeOutputStream.CodecName
-					// }
+					setVideoProbe(filename, ffprobeOutput)
 				}
 			}
 		}
+
+		applyMetadataDefaults()
 	})
 
 	wnd.Run(loop)
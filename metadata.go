@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var metadataModeComboBoxLists = []string{
+	"keep",
+	"strip all",
+}
+var metadataModeComboBoxIdx int32 = 0
+var metadataModeToUse = "keep"
+
+var keepChapters = true
+var keepAttachments = false
+var keepCreationTime = true
+var metadataTitle string
+var metadataArtist string
+var metadataComment string
+var metadataHelperMsg string
+
+func (o ffprobeOutput) hasAttachments() bool {
+	for _, stream := range o.Streams {
+		if "attachment" == stream.CodecType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o ffprobeOutput) hasGPSLocation() bool {
+	return "" != o.Format.Tags.Location || "" != o.Format.Tags.LocationEng || "" != o.Format.Tags.LocationISO6709
+}
+
+// applyMetadataDefaults sets metadata options according to what dropped sources contain
+func applyMetadataDefaults() {
+	keepChapters = false
+	keepAttachments = false
+	metadataHelperMsg = ""
+
+	gpsCount := 0
+	for _, videoPath := range listOfVideos {
+		probe, _ := videoProbeOf(videoPath)
+		if 0 < len(probe.Chapters) {
+			keepChapters = true
+		}
+		if probe.hasAttachments() {
+			keepAttachments = true
+		}
+		if probe.hasGPSLocation() {
+			gpsCount++
+		}
+	}
+
+	if 0 < gpsCount {
+		metadataHelperMsg = fmt.Sprintf("%d file(s) contain GPS location, use \"strip all\" to remove it", gpsCount)
+	}
+}
+
+// metadataKwargs adds metadata, chapters and attachments options for converting videoPath into convertedPath
+func metadataKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath, convertedPath string) {
+	var tags []string
+
+	if "strip all" == s.MetadataMode {
+		args["map_metadata"] = "-1"
+		args["map_metadata:s:v"] = "-1"
+		args["map_metadata:s:a"] = "-1"
+		args["map_chapters"] = "-1"
+		// bitexact keeps muxer and encoder from writing their own version tags
+		args["fflags"] = "+bitexact"
+		args["flags:v"] = "+bitexact"
+		args["flags:a"] = "+bitexact"
+	} else {
+		args["map_metadata"] = "0"
+		args["map_metadata:s:v"] = "0:s:v"
+		args["map_metadata:s:a"] = "0:s:a"
+
+		if s.KeepChapters {
+			args["map_chapters"] = "0"
+		} else {
+			args["map_chapters"] = "-1"
+		}
+
+		// only matroska can hold attachments such as subtitle fonts
+		probe, ok := videoProbeOf(videoPath)
+		if s.KeepAttachments && ok && probe.hasAttachments() && ".mkv" == strings.ToLower(filepath.Ext(convertedPath)) {
+			args["map"] = []string{"0:v", "0:a?", "0:s?", "0:t"}
+			args["c:s"] = "copy"
+			args["c:t"] = "copy"
+		}
+
+		if !s.KeepCreationTime {
+			tags = append(tags, "creation_time=")
+		}
+	}
+
+	for _, tag := range []struct{ key, value string }{
+		{"title", s.MetadataTitle},
+		{"artist", s.MetadataArtist},
+		{"comment", s.MetadataComment},
+	} {
+		if "" != tag.value {
+			tags = append(tags, fmt.Sprintf("%s=%s", tag.key, tag.value))
+		}
+	}
+
+	if 0 < len(tags) {
+		args["metadata"] = tags
+	}
+}
+
+func metadataLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Row(
+			g.Label("metadata"),
+			g.Dummy(10, 0),
+			g.Combo("##metadata", metadataModeComboBoxLists[metadataModeComboBoxIdx], metadataModeComboBoxLists, &metadataModeComboBoxIdx).OnChange(func() {
+				metadataModeToUse = metadataModeComboBoxLists[metadataModeComboBoxIdx]
+			}),
+		),
+	}
+
+	if "keep" == metadataModeToUse {
+		widgets = append(widgets, g.Row(
+			g.Checkbox("chapters", &keepChapters),
+			g.Checkbox("attachments (mkv)", &keepAttachments),
+			g.Checkbox("creation time", &keepCreationTime),
+		))
+	}
+
+	widgets = append(widgets, []g.Widget{
+		g.InputText(&metadataTitle).Hint("title tag").Size(-1),
+		g.InputText(&metadataArtist).Hint("artist tag").Size(-1),
+		g.InputText(&metadataComment).Hint("comment tag").Size(-1),
+	}...)
+
+	if "" != metadataHelperMsg {
+		widgets = append(widgets, g.Label(metadataHelperMsg).Wrapped(true))
+	}
+
+	return widgets
+}
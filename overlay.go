@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/AllenDang/giu"
+)
+
+var overlayPositionComboBoxLists = []string{
+	"bottom right",
+	"bottom left",
+	"top right",
+	"top left",
+	"center",
+}
+
+var watermarkPositionComboBoxIdx int32 = 0
+var watermarkPositionToUse = "bottom right"
+var watermarkImage string
+var watermarkOpacity float32 = 0.8
+var watermarkScale float32 = 15
+
+var textPositionComboBoxIdx int32 = 3
+var textPositionToUse = "top left"
+var overlayText string
+var textFont string
+var textSize int32 = 36
+var textColor = "white"
+var textBox bool
+var textBoxColor = "black@0.5"
+
+var overlayMargin int32 = 20
+
+// overlayPosition returns x and y expressions of overlay placed at position with margin.
+// width and height are names of main frame size, overlayWidth and overlayHeight of overlay size in the filter.
+func overlayPosition(position string, margin int32, width, height, overlayWidth, overlayHeight string) string {
+	m := strconv.Itoa(int(margin))
+
+	switch position {
+	case "bottom left":
+		return fmt.Sprintf("%s:%s-%s-%s", m, height, overlayHeight, m)
+	case "top right":
+		return fmt.Sprintf("%s-%s-%s:%s", width, overlayWidth, m, m)
+	case "top left":
+		return fmt.Sprintf("%s:%s", m, m)
+	case "center":
+		return fmt.Sprintf("(%s-%s)/2:(%s-%s)/2", width, overlayWidth, height, overlayHeight)
+	}
+
+	return fmt.Sprintf("%s-%s-%s:%s-%s-%s", width, overlayWidth, m, height, overlayHeight, m)
+}
+
+// isOverlaying reports whether watermark or text is stamped on output
+func isOverlaying(s conversionSettings) bool {
+	return isVideoFiltering(s) && ("" != strings.TrimSpace(s.WatermarkImage) || "" != strings.TrimSpace(s.OverlayText))
+}
+
+// escapeDrawtextExpansion escapes text so that drawtext prints it as is, instead of expanding %{...}
+func escapeDrawtextExpansion(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`).Replace(s)
+}
+
+// quoteFilterOption escapes value of a filter option in filter graph: first for option parser,
+// then quoted for graph parser so that commas and brackets are kept
+func quoteFilterOption(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// overlayTextFor expands tokens of overlay text for videoPath: {filename}, {name} and {date} are fixed
+// on conversion, {timecode} shows position in output while playing
+func overlayTextFor(s conversionSettings, videoPath string) string {
+	filename := filepath.Base(videoPath)
+
+	return expandTemplate(escapeDrawtextExpansion(s.OverlayText), map[string]string{
+		"filename": escapeDrawtextExpansion(filename),
+		"name":     escapeDrawtextExpansion(strings.TrimSuffix(filename, filepath.Ext(filename))),
+		"date":     time.Now().Format("2006-01-02"),
+		"timecode": "%{pts:hms}",
+	})
+}
+
+// drawtextFilter returns drawtext filter stamping overlay text of videoPath
+func drawtextFilter(s conversionSettings, videoPath string) (string, error) {
+	fontPath := strings.TrimSpace(s.TextFont)
+	if "" == fontPath {
+		// embedded font has Hangul, which fonts found by fontconfig may not
+		var err error
+		if fontPath, err = embeddedFontPath(); nil != err {
+			return "", err
+		}
+	} else if _, err := os.Stat(fontPath); nil != err {
+		return "", fmt.Errorf("font: %w", err)
+	}
+
+	if 0 >= s.TextSize {
+		return "", fmt.Errorf("text size should be positive")
+	}
+
+	options := []string{
+		fmt.Sprintf("fontfile=%s", quoteFilterOption(fontPath)),
+		fmt.Sprintf("text=%s", quoteFilterOption(overlayTextFor(s, videoPath))),
+		fmt.Sprintf("fontsize=%d", s.TextSize),
+		fmt.Sprintf("fontcolor=%s", quoteFilterOption(s.TextColor)),
+	}
+	if s.TextBox {
+		options = append(options, "box=1", fmt.Sprintf("boxcolor=%s", quoteFilterOption(s.TextBoxColor)), "boxborderw=8")
+	}
+
+	position := strings.SplitN(overlayPosition(s.TextPosition, s.OverlayMargin, "w", "h", "tw", "th"), ":", 2)
+	options = append(options, fmt.Sprintf("x=%s", position[0]), fmt.Sprintf("y=%s", position[1]))
+
+	return "drawtext=" + strings.Join(options, ":"), nil
+}
+
+// withOverlays appends watermark and text overlay onto video filter chain of videoPath.
+// Watermark image is read with movie source, so that the chain stays a single -filter:v graph.
+func withOverlays(s conversionSettings, chain, videoPath string) (string, error) {
+	if !isOverlaying(s) {
+		return chain, nil
+	}
+
+	if image := strings.TrimSpace(s.WatermarkImage); "" != image {
+		if _, err := os.Stat(image); nil != err {
+			return "", fmt.Errorf("watermark: %w", err)
+		}
+		if 0 > s.WatermarkOpacity || 1 < s.WatermarkOpacity {
+			return "", fmt.Errorf("watermark opacity should be between 0 and 1")
+		}
+
+		if "" == chain {
+			chain = "null"
+		}
+
+		logo := fmt.Sprintf("movie=%s,format=rgba,colorchannelmixer=aa=%s",
+			quoteFilterOption(image), strconv.FormatFloat(float64(s.WatermarkOpacity), 'f', -1, 32))
+
+		// size of watermark is relative to video width, so that it looks the same on any resolution
+		if 0 < s.WatermarkScale {
+			chain = fmt.Sprintf("%s[base];%s[logo];[logo][base]scale2ref=w=main_w*%s/100:h=ow/a[scaledlogo][scaledbase];[scaledbase][scaledlogo]overlay=%s",
+				chain, logo, strconv.FormatFloat(float64(s.WatermarkScale), 'f', -1, 32),
+				overlayPosition(s.WatermarkPosition, s.OverlayMargin, "W", "H", "w", "h"))
+		} else {
+			chain = fmt.Sprintf("%s[base];%s[logo];[base][logo]overlay=%s",
+				chain, logo, overlayPosition(s.WatermarkPosition, s.OverlayMargin, "W", "H", "w", "h"))
+		}
+	}
+
+	if "" != strings.TrimSpace(s.OverlayText) {
+		drawtext, err := drawtextFilter(s, videoPath)
+		if nil != err {
+			return "", err
+		}
+
+		if "" == chain {
+			chain = drawtext
+		} else {
+			chain += "," + drawtext
+		}
+	}
+
+	return chain, nil
+}
+
+func overlayLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.InputText(&watermarkImage).Hint("watermark image, e.g. /path/to/logo.png").Size(-1),
+	}
+
+	if "" != strings.TrimSpace(watermarkImage) {
+		widgets = append(widgets, g.Row(
+			g.Combo("##watermarkposition", overlayPositionComboBoxLists[watermarkPositionComboBoxIdx], overlayPositionComboBoxLists, &watermarkPositionComboBoxIdx).Size(110).OnChange(func() {
+				watermarkPositionToUse = overlayPositionComboBoxLists[watermarkPositionComboBoxIdx]
+			}),
+			g.InputFloat(&watermarkOpacity).Label("opacity").Format("%.2f").Size(60),
+			g.InputFloat(&watermarkScale).Label("% of width").Format("%.0f").Size(60),
+		))
+	}
+
+	widgets = append(widgets, g.InputText(&overlayText).Hint("text, e.g. CONFIDENTIAL {filename} {date} {timecode}").Size(-1))
+
+	if "" != strings.TrimSpace(overlayText) {
+		widgets = append(widgets, []g.Widget{
+			g.Row(
+				g.Combo("##textposition", overlayPositionComboBoxLists[textPositionComboBoxIdx], overlayPositionComboBoxLists, &textPositionComboBoxIdx).Size(110).OnChange(func() {
+					textPositionToUse = overlayPositionComboBoxLists[textPositionComboBoxIdx]
+				}),
+				g.InputInt(&textSize).Label("size").Size(60),
+				g.InputText(&textColor).Label("color").Size(80),
+			),
+			g.Row(
+				g.Checkbox("box", &textBox),
+				g.InputText(&textBoxColor).Label("box color").Size(100),
+			),
+			g.InputText(&textFont).Hint("font file, embedded NanumGothic if empty").Size(-1),
+		}...)
+	}
+
+	widgets = append(widgets, g.InputInt(&overlayMargin).Label("margin").Size(60))
+
+	return []g.Widget{
+		g.TreeNode("watermark and text").Layout(widgets...),
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var pixelFormatComboBoxLists = []string{
+	"auto",
+	"compatible",
+	"keep source",
+	"10-bit",
+}
+var pixelFormatComboBoxIdx int32 = 0
+var pixelFormatToUse = "auto"
+
+// pixelFormatExplanations tells consequence of each pixel format choice, shown on GUI
+var pixelFormatExplanations = map[string]string{
+	"auto":        "compatible for mp4, otherwise encoder keeps source as close as it can",
+	"compatible":  "8-bit 4:2:0 (yuv420p), plays everywhere; 10-bit sources lose precision and may show banding",
+	"keep source": "10-bit or 4:2:2 stays as is; such H.264 does not play on many players, browsers and TVs",
+	"10-bit":      "10-bit 4:2:0 (yuv420p10le), less banding; H.265 Main10 plays widely, H.264 High10 hardly does",
+}
+
+// pixelFormat returns pixel format of first video stream, empty if there is no video
+func (o ffprobeOutput) pixelFormat() string {
+	idx, ok := o.videoStream()
+	if !ok {
+		return ""
+	}
+
+	return o.Streams[idx].PixFmt
+}
+
+// isCompatiblePixelFormat reports whether pixel format is 8-bit 4:2:0, which every player decodes
+func isCompatiblePixelFormat(pixFmt string) bool {
+	return "" == pixFmt || "yuv420p" == pixFmt || "yuvj420p" == pixFmt || "nv12" == pixFmt
+}
+
+// targetPixelFormat returns pixel format of output for videoPath, empty to leave it to encoder
+func targetPixelFormat(s conversionSettings, videoPath string) string {
+	switch s.PixelFormat {
+	case "compatible":
+		return "yuv420p"
+	case "10-bit":
+		return "yuv420p10le"
+	case "keep source":
+		return ""
+	}
+
+	ext := strings.ToLower(filepath.Ext(convertedPathFor(s, videoPath)))
+	if ".mp4" == ext || ".m4v" == ext {
+		return "yuv420p"
+	}
+
+	return ""
+}
+
+// pixelFormatKwargs sets output pixel format for videoPath. Automatic choice is skipped when video is copied,
+// explicit one is set anyway so that it is warned as needing re-encoding.
+func pixelFormatKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath string) {
+	if "copy" == args["c:v"] && "auto" == s.PixelFormat {
+		return
+	}
+
+	if pixFmt := targetPixelFormat(s, videoPath); "" != pixFmt {
+		args["pix_fmt"] = pixFmt
+	}
+}
+
+// pixelFormatChanges reports whether output of videoPath gets pixel format other than source
+func pixelFormatChanges(s conversionSettings, videoPath string) bool {
+	if "original" == s.VideoCodec && "auto" == s.PixelFormat {
+		return false
+	}
+
+	probe, _ := videoProbeOf(videoPath)
+	source, target := probe.pixelFormat(), targetPixelFormat(s, videoPath)
+	if "" == source || "" == target {
+		return false
+	}
+	if "yuv420p" == target {
+		return !isCompatiblePixelFormat(source)
+	}
+
+	return source != target
+}
+
+// incompatiblePixelFormatVideos returns videos in list which are not 8-bit 4:2:0, with its pixel format
+func incompatiblePixelFormatVideos() []string {
+	var ret []string
+
+	for _, videoPath := range listOfVideos {
+		probe, _ := videoProbeOf(videoPath)
+		if pixFmt := probe.pixelFormat(); !isCompatiblePixelFormat(pixFmt) {
+			ret = append(ret, fmt.Sprintf("%s (%s)", filepath.Base(videoPath), pixFmt))
+		}
+	}
+
+	return ret
+}
+
+func pixelFormatLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Row(
+			g.Label("pixel format"),
+			g.Dummy(10, 0),
+			g.Combo("##pixelformat", pixelFormatComboBoxLists[pixelFormatComboBoxIdx], pixelFormatComboBoxLists, &pixelFormatComboBoxIdx).Size(110).OnChange(func() {
+				pixelFormatToUse = pixelFormatComboBoxLists[pixelFormatComboBoxIdx]
+			}),
+		),
+		g.Label(pixelFormatExplanations[pixelFormatToUse]).Wrapped(true),
+	}
+
+	if videos := incompatiblePixelFormatVideos(); 0 < len(videos) {
+		widgets = append(widgets, g.Label(fmt.Sprintf("not 8-bit 4:2:0: %s", strings.Join(videos, ", "))).Wrapped(true))
+	}
+
+	return widgets
+}
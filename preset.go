@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+)
+
+// presets and presetNames are replaced, never written in place, under presetsMutex.
+// GUI thread is the only writer and reads them directly, other goroutines go through presetOf and listPresetNames.
+var presetsMutex sync.Mutex
+var presets = map[string]conversionSettings{}
+var presetNames []string
+var presetComboBoxIdx int32 = 0
+var presetNameToSave string
+var presetHelperMsg string
+
+func presetsFilePath() string {
+	return filepath.Join(appDataDir(), "presets.json")
+}
+
+func loadPresets() error {
+	data, err := os.ReadFile(presetsFilePath())
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	loaded := map[string]conversionSettings{}
+	if err := json.Unmarshal(data, &loaded); nil != err {
+		return err
+	}
+
+	setPresets(loaded)
+
+	return nil
+}
+
+// setPresets replaces presets and their sorted names
+func setPresets(replaced map[string]conversionSettings) {
+	names := make([]string, 0, len(replaced))
+	for name := range replaced {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	presetsMutex.Lock()
+	presets = replaced
+	presetNames = names
+	presetsMutex.Unlock()
+}
+
+func presetOf(name string) (conversionSettings, bool) {
+	presetsMutex.Lock()
+	defer presetsMutex.Unlock()
+
+	s, ok := presets[name]
+	return s, ok
+}
+
+// listPresetNames returns sorted preset names, never nil
+func listPresetNames() []string {
+	presetsMutex.Lock()
+	defer presetsMutex.Unlock()
+
+	return append([]string{}, presetNames...)
+}
+
+func savePreset(name string, s conversionSettings) error {
+	name = strings.TrimSpace(name)
+	if "" == name {
+		return fmt.Errorf("preset name is empty")
+	}
+
+	replaced := make(map[string]conversionSettings, len(presets)+1)
+	for key, value := range presets {
+		replaced[key] = value
+	}
+	replaced[name] = s
+	setPresets(replaced)
+
+	data, err := json.MarshalIndent(replaced, "", "  ")
+	if nil != err {
+		return err
+	}
+
+	return os.WriteFile(presetsFilePath(), data, os.FileMode(0644))
+}
+
+func presetLayouts() []g.Widget {
+	var widgets []g.Widget
+
+	if 0 < len(presetNames) {
+		if int(presetComboBoxIdx) >= len(presetNames) {
+			presetComboBoxIdx = 0
+		}
+
+		widgets = append(widgets, g.Row(
+			g.Label("preset"),
+			g.Dummy(10, 0),
+			g.Combo("##preset", presetNames[presetComboBoxIdx], presetNames, &presetComboBoxIdx).Size(200),
+			g.Button("Load").OnClick(func() {
+				applySettings(presets[presetNames[presetComboBoxIdx]])
+				presetHelperMsg = fmt.Sprintf("loaded preset %s", presetNames[presetComboBoxIdx])
+			}).Disabled(isCurrentlyConverting),
+		))
+	}
+
+	widgets = append(widgets, g.Row(
+		g.InputText(&presetNameToSave).Hint("preset name").Size(200),
+		g.Button("Save preset").OnClick(func() {
+			if err := savePreset(presetNameToSave, currentSettings()); nil != err {
+				presetHelperMsg = err.Error()
+			} else {
+				presetHelperMsg = fmt.Sprintf("saved preset %s", presetNameToSave)
+			}
+		}),
+	))
+
+	if "" != presetHelperMsg {
+		widgets = append(widgets, g.Label(presetHelperMsg).Wrapped(true))
+	}
+
+	return widgets
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var previewOffset = "10%"
+var previewDuration int32 = 10
+
+var isPreviewing bool
+var previewHelperMsg string
+var lastPreview previewResult
+
+// previewResult is a short segment encoded with current settings, with size extrapolated to whole source
+type previewResult struct {
+	OutputPath     string
+	BeforePath     string
+	AfterPath      string
+	Size           int64
+	Duration       float64
+	SourceDuration float64
+	EstimatedSize  int64
+}
+
+func (p previewResult) String() string {
+	ret := fmt.Sprintf("preview of %.1fs is %s", p.Duration, formatSize(p.Size))
+	if 0 < p.EstimatedSize {
+		ret += fmt.Sprintf(", about %s for whole %s", formatSize(p.EstimatedSize), time.Duration(p.SourceDuration*float64(time.Second)).Round(time.Second))
+	}
+
+	return ret
+}
+
+// formatSize returns human readable size of bytes
+func formatSize(size int64) string {
+	const unit = 1024
+	if unit > size {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value, exp := float64(size)/unit, 0
+	for unit <= value && 4 > exp {
+		value /= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTP"[exp])
+}
+
+// isPreviewable reports whether output of current mode is a single file which can be played
+func isPreviewable(s conversionSettings) bool {
+	return !isImageOutputMode(s) && !isStreamingOutputMode(s)
+}
+
+// openWithDefaultApp opens path with application associated to it, e.g. system player for videos
+func openWithDefaultApp(path string) error {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		// not through cmd, which would interpret & ^ % in file name
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+
+	return cmd.Start()
+}
+
+// grabFrame saves a frame of videoPath at position into imagePath
+func grabFrame(videoPath string, position float64, imagePath string) error {
+	output, err := exec.Command("ffmpeg",
+		"-hide_banner", "-v", "error",
+		"-ss", strconv.FormatFloat(position, 'f', 3, 64),
+		"-i", videoPath,
+		"-frames:v", "1",
+		"-y", imagePath,
+	).CombinedOutput()
+	if nil != err {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// encodePreview encodes preview duration seconds of videoPath from preview offset with s,
+// into temporary directory, then grabs a frame of source and preview at the middle of it
+func encodePreview(s conversionSettings, videoPath string) (previewResult, error) {
+	var ret previewResult
+
+	source, _ := videoProbeOf(videoPath)
+	ret.SourceDuration = source.duration()
+
+	start, err := parsePosition(s.PreviewOffset, ret.SourceDuration)
+	if nil != err {
+		return ret, err
+	}
+	if 0 >= s.PreviewDuration {
+		return ret, fmt.Errorf("preview length must be positive")
+	}
+
+	// not in shared temp directory, where other users could plant files under the fixed names
+	dir := filepath.Join(appDataDir(), "preview")
+	if err := os.MkdirAll(dir, os.FileMode(0755)); nil != err {
+		return ret, err
+	}
+	ret.OutputPath = filepath.Join(dir, "preview-"+filepath.Base(convertedPathFor(s, videoPath)))
+
+	inputKwargs, outputKwargs, _, err := ffmpegKwargs(s, videoPath, ret.OutputPath)
+	if nil != err {
+		return ret, err
+	}
+	inputKwargs["ss"] = strconv.FormatFloat(start, 'f', 3, 64)
+	inputKwargs["t"] = strconv.Itoa(int(s.PreviewDuration))
+
+	var stderr bytes.Buffer
+	err = ffmpeg.Input(videoPath, inputKwargs).Output(ret.OutputPath, outputKwargs).OverWriteOutput().WithErrorOutput(&stderr).Run()
+	if nil != err {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return ret, fmt.Errorf("%s: %s", err, lines[len(lines)-1])
+	}
+
+	stat, err := os.Stat(ret.OutputPath)
+	if nil != err {
+		return ret, err
+	}
+	ret.Size = stat.Size()
+
+	output, err := detectWithFfprobe(ret.OutputPath)
+	if nil != err {
+		return ret, err
+	}
+	ret.Duration = output.duration()
+
+	// preview and whole output are both sped up, so output duration is compared with sped up source
+	if 0 < ret.Duration && 0 < ret.SourceDuration {
+		ret.EstimatedSize = int64(float64(ret.Size) * ret.SourceDuration / playbackSpeedFactor(s) / ret.Duration)
+	}
+
+	// frame grabs are nice to have, preview is still useful without them
+	if "extract audio" != s.OutputMode && 0 < ret.Duration {
+		before := filepath.Join(dir, "preview-before.png")
+		after := filepath.Join(dir, "preview-after.png")
+		if nil == grabFrame(videoPath, start+ret.Duration*playbackSpeedFactor(s)/2, before) && nil == grabFrame(ret.OutputPath, ret.Duration/2, after) {
+			ret.BeforePath, ret.AfterPath = before, after
+		}
+	}
+
+	return ret, nil
+}
+
+// runPreview encodes preview of videoPath and opens it in system player
+func runPreview(s conversionSettings, videoPath string) {
+	isPreviewing = true
+	defer func() {
+		isPreviewing = false
+		g.Update()
+	}()
+
+	lastPreview = previewResult{}
+	previewHelperMsg = fmt.Sprintf("encoding preview:\n %s", videoPath)
+
+	preview, err := encodePreview(s, videoPath)
+	if nil != err {
+		previewHelperMsg = fmt.Sprintf("preview failed: %s", err)
+		return
+	}
+
+	lastPreview = preview
+	previewHelperMsg = preview.String()
+	if isCrfSearchable(s, videoPath) {
+		previewHelperMsg += "\ncrf is searched on conversion, preview uses codec default"
+	}
+	if isAutoCrop(s) {
+		previewHelperMsg += "\ncrop is detected on conversion, preview is not cropped"
+	}
+
+	if err := openWithDefaultApp(preview.OutputPath); nil != err {
+		previewHelperMsg += fmt.Sprintf("\nfailed to open preview: %s", err)
+	}
+}
+
+func previewLayouts() []g.Widget {
+	if !isPreviewable(currentSettings()) {
+		return nil
+	}
+
+	widgets := []g.Widget{
+		g.Row(
+			g.InputText(&previewOffset).Label("from").Hint("10% or 00:01:30").Size(80),
+			g.InputInt(&previewDuration).Label("seconds").Size(60),
+			g.Button("Preview").OnClick(func() {
+				if 0 < len(listOfVideos) {
+					go runPreview(currentSettings(), listOfVideos[0])
+				}
+			}).Disabled(isPreviewing),
+		),
+	}
+
+	if "" != previewHelperMsg {
+		widgets = append(widgets, g.Label(previewHelperMsg).Wrapped(true))
+	}
+
+	if "" != lastPreview.OutputPath && !isPreviewing {
+		buttons := []g.Widget{
+			g.Button("Open preview").OnClick(func() {
+				openWithDefaultApp(lastPreview.OutputPath)
+			}),
+		}
+		if "" != lastPreview.BeforePath {
+			buttons = append(buttons,
+				g.Button("Open before").OnClick(func() {
+					openWithDefaultApp(lastPreview.BeforePath)
+				}),
+				g.Button("Open after").OnClick(func() {
+					openWithDefaultApp(lastPreview.AfterPath)
+				}),
+			)
+		}
+		widgets = append(widgets, g.Row(buttons...))
+	}
+
+	return []g.Widget{
+		g.TreeNode("preview first file").Layout(widgets...),
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+)
+
+// qualityMetricFilters maps quality metrics to ffmpeg filter computing it
+var qualityMetricFilters = map[string]string{
+	"VMAF": "libvmaf",
+	"SSIM": "ssim",
+	"PSNR": "psnr",
+}
+
+var qualityMetricComboBoxIdx int32 = 0
+var qualityMetricToUse = "none"
+
+var ffmpegFiltersMutex sync.Mutex
+var ffmpegFilters map[string]bool
+
+var (
+	vmafScoreRegexp = regexp.MustCompile(`VMAF score[:=]\s*([0-9.]+)`)
+	ssimScoreRegexp = regexp.MustCompile(`SSIM .*All:([0-9.]+)`)
+	psnrScoreRegexp = regexp.MustCompile(`PSNR .*average:([0-9.]+|inf)`)
+)
+
+// psnrIdentical is PSNR recorded for identical frames
+const psnrIdentical = 100
+
+// qualityScore is a quality metric of output compared to source
+type qualityScore struct {
+	Metric string  `json:"metric"`
+	Score  float64 `json:"score"`
+}
+
+func (q qualityScore) String() string {
+	return fmt.Sprintf("%s %.4g", q.Metric, q.Score)
+}
+
+// probeFfmpegFilters lists filters ffmpeg on PATH is built with, so that optional features are offered only when available
+func probeFfmpegFilters() {
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output()
+
+	filters := map[string]bool{}
+	if nil == err {
+		for _, line := range strings.Split(string(output), "\n") {
+			fields := strings.Fields(line)
+			if 3 <= len(fields) {
+				filters[fields[1]] = true
+			}
+		}
+	}
+
+	ffmpegFiltersMutex.Lock()
+	ffmpegFilters = filters
+	ffmpegFiltersMutex.Unlock()
+}
+
+func hasFfmpegFilter(name string) bool {
+	ffmpegFiltersMutex.Lock()
+	defer ffmpegFiltersMutex.Unlock()
+
+	return ffmpegFilters[name]
+}
+
+// qualityMetricLists returns quality metrics which ffmpeg can compute, with "none" first
+func qualityMetricLists() []string {
+	ret := []string{"none"}
+	for _, metric := range []string{"VMAF", "SSIM", "PSNR"} {
+		if hasFfmpegFilter(qualityMetricFilters[metric]) {
+			ret = append(ret, metric)
+		}
+	}
+
+	return ret
+}
+
+// qualityFilterGraph returns filter graph comparing output (first input) with source of videoPath (second input).
+// Source gets the same crop, rotation and speed as output, then output is scaled back to its size and
+// source is brought to output frame rate, so that frames line up.
+func qualityFilterGraph(s conversionSettings, metric, videoPath string, output ffprobeOutput) string {
+	distorted := []string{}
+	reference, referenceWidth, referenceHeight := framingFilters(s, videoPath)
+	if speed := speedFilter(s); "" != speed {
+		reference = append(reference, speed)
+	}
+
+	outputWidth, outputHeight := output.displaySize()
+	if 0 < referenceWidth && 0 < referenceHeight && (referenceWidth != outputWidth || referenceHeight != outputHeight) {
+		distorted = append(distorted, fmt.Sprintf("scale=%d:%d:flags=bicubic", referenceWidth, referenceHeight))
+	}
+
+	source, _ := videoProbeOf(videoPath)
+	_, sourceFrameRate := source.frameRates()
+	_, outputFrameRate := output.frameRates()
+	if 0 < sourceFrameRate && 0 < outputFrameRate && (1 != playbackSpeedFactor(s) || 0.01 < math.Abs(sourceFrameRate-outputFrameRate)/outputFrameRate) {
+		reference = append(reference, fmt.Sprintf("fps=%s", strconv.FormatFloat(outputFrameRate, 'f', 3, 64)))
+	}
+
+	distorted = append(distorted, "setsar=1", "format=yuv420p", "setpts=PTS-STARTPTS")
+	reference = append(reference, "setsar=1", "format=yuv420p", "setpts=PTS-STARTPTS")
+
+	return fmt.Sprintf("[0:v]%s[distorted];[1:v]%s[reference];[distorted][reference]%s",
+		strings.Join(distorted, ","), strings.Join(reference, ","), qualityMetricFilters[metric])
+}
+
+// parseQualityScore finds score of metric printed by its filter at the end of ffmpeg stderr
+func parseQualityScore(metric, output string) (float64, error) {
+	var re *regexp.Regexp
+	switch metric {
+	case "VMAF":
+		re = vmafScoreRegexp
+	case "SSIM":
+		re = ssimScoreRegexp
+	case "PSNR":
+		re = psnrScoreRegexp
+	default:
+		return 0, fmt.Errorf("unknown quality metric %s", metric)
+	}
+
+	matches := re.FindAllStringSubmatch(output, -1)
+	if 0 == len(matches) {
+		return 0, fmt.Errorf("%s score not found", metric)
+	}
+
+	score := matches[len(matches)-1][1]
+	// PSNR of identical frames is infinite, which JSON cannot hold. Cap it as other tools do.
+	if "inf" == score {
+		return psnrIdentical, nil
+	}
+
+	return strconv.ParseFloat(score, 64)
+}
+
+// isQualityAnalyzable reports whether output of current mode has video to compare with source
+func isQualityAnalyzable(s conversionSettings, convertedPath string) bool {
+	return "convert video" == s.OutputMode && isSingleOutputFile(convertedPath)
+}
+
+// analyzeQuality computes quality metric of convertedPath against videoPath, returns score and history result with message
+func analyzeQuality(s conversionSettings, metric, videoPath, convertedPath string) (qualityScore, string, string) {
+	score, result, message := measureQuality(s, metric, videoPath, convertedPath, []string{"-i", videoPath})
+	if historyResultSuccess != result {
+		return qualityScore{}, result, message
+	}
+
+	return qualityScore{Metric: metric, Score: score}, historyResultSuccess, ""
+}
+
+// measureQuality computes quality metric of convertedPath against source of videoPath given as ffmpeg input args
+// (so that only a part of source can be compared), returns score and history result with message
+func measureQuality(s conversionSettings, metric, videoPath, convertedPath string, referenceArgs []string) (float64, string, string) {
+	if !hasFfmpegFilter(qualityMetricFilters[metric]) {
+		return 0, historyResultFailed, fmt.Sprintf("ffmpeg is not built with %s", qualityMetricFilters[metric])
+	}
+
+	output, err := detectWithFfprobe(convertedPath)
+	if nil != err {
+		return 0, historyResultFailed, err.Error()
+	}
+
+	args := []string{"-hide_banner", "-nostats", "-i", convertedPath}
+	args = append(args, referenceArgs...)
+	args = append(args, "-lavfi", qualityFilterGraph(s, metric, videoPath, output), "-f", "null", "-")
+
+	var stderr bytes.Buffer
+	ffmpegCmd := exec.Command("ffmpeg", args...)
+	ffmpegCmd.Stderr = io.MultiWriter(&stderr, &convertingFFmpegOutput)
+
+	result, message := runFfmpegCmd(ffmpegCmd, convertedPath)
+	if historyResultSuccess != result {
+		return 0, result, message
+	}
+
+	score, err := parseQualityScore(metric, stderr.String())
+	if nil != err {
+		return 0, historyResultFailed, err.Error()
+	}
+
+	return score, historyResultSuccess, ""
+}
+
+func qualityLayouts() []g.Widget {
+	metrics := qualityMetricLists()
+	if 1 == len(metrics) {
+		return []g.Widget{
+			g.Label("quality analysis: ffmpeg has none of libvmaf, ssim and psnr filters"),
+		}
+	}
+
+	qualityMetricComboBoxIdx = comboBoxIndexOf(metrics, qualityMetricToUse)
+
+	return []g.Widget{
+		g.Row(
+			g.Label("quality analysis"),
+			g.Dummy(10, 0),
+			g.Combo("##qualitymetric", metrics[qualityMetricComboBoxIdx], metrics, &qualityMetricComboBoxIdx).Size(80).OnChange(func() {
+				qualityMetricToUse = metrics[qualityMetricComboBoxIdx]
+			}),
+		),
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+)
+
+// partialMarker is put in name of output being written, so that leftovers of a crash are found
+const partialMarker = ".partial"
+
+var queueFileMutex sync.Mutex
+
+// recoveredJobs are jobs left unfinished by last run, until they are resumed or discarded
+var recoveredJobs []job
+var orphanedPartials []string
+var recoveryHelperMsg string
+
+func queueFilePath() string {
+	return filepath.Join(appDataDir(), "queue.json")
+}
+
+// partialPathFor returns hidden temporary path output is written to before renamed into convertedPath.
+// Extension is kept so that ffmpeg picks the same muxer. Empty if output is not a single file.
+func partialPathFor(s conversionSettings, convertedPath string) string {
+	if isStreamingOutputMode(s) || !isSingleOutputFile(convertedPath) {
+		return ""
+	}
+
+	ext := filepath.Ext(convertedPath)
+	name := strings.TrimSuffix(filepath.Base(convertedPath), ext)
+
+	return filepath.Join(filepath.Dir(convertedPath), fmt.Sprintf(".%s%s%s", name, partialMarker, ext))
+}
+
+// isPartialPath reports whether path is named by partialPathFor
+func isPartialPath(path string) bool {
+	name := filepath.Base(path)
+
+	return strings.HasPrefix(name, ".") && strings.Contains(strings.TrimSuffix(name, filepath.Ext(name)), partialMarker)
+}
+
+// finishPartialOutput renames completed partial output into convertedPath, removes it if conversion did not succeed
+func finishPartialOutput(partialPath, convertedPath, result string) error {
+	if historyResultSuccess != result {
+		os.Remove(partialPath)
+		return nil
+	}
+
+	if err := os.Rename(partialPath, convertedPath); nil != err {
+		os.Remove(partialPath)
+		return err
+	}
+
+	return nil
+}
+
+// saveQueue writes jobs not finished yet into queue file, along with recovered jobs still waiting for decision.
+// File is replaced by rename, so a crash while writing leaves the previous one intact.
+func saveQueue() error {
+	queueFileMutex.Lock()
+	defer queueFileMutex.Unlock()
+
+	jobsMutex.Lock()
+	unfinished := append([]job(nil), recoveredJobs...)
+	for _, j := range jobs {
+		if jobStatusQueued == j.Status || jobStatusRunning == j.Status {
+			unfinished = append(unfinished, *j)
+		}
+	}
+	jobsMutex.Unlock()
+
+	path := queueFilePath()
+	if 0 == len(unfinished) {
+		if err := os.Remove(path); nil != err && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(unfinished, "", "  ")
+	if nil != err {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, os.FileMode(0644)); nil != err {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// persistQueue saves queue, reporting failure on GUI instead of failing conversion
+func persistQueue() {
+	if err := saveQueue(); nil != err {
+		recoveryHelperMsg = fmt.Sprintf("failed to save queue: %s", err)
+	}
+}
+
+// loadQueue reads jobs left unfinished by last run, and partial outputs next to their inputs
+func loadQueue() error {
+	data, err := os.ReadFile(queueFilePath())
+	if nil != err {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var unfinished []job
+	if err := json.Unmarshal(data, &unfinished); nil != err {
+		return err
+	}
+
+	dirs := map[string]bool{}
+	for _, j := range unfinished {
+		dirs[filepath.Dir(j.InputPath)] = true
+	}
+
+	var partials []string
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if nil != err {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isPartialPath(entry.Name()) {
+				partials = append(partials, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	jobsMutex.Lock()
+	recoveredJobs = unfinished
+	orphanedPartials = partials
+	jobsMutex.Unlock()
+
+	return nil
+}
+
+// resumeRecoveredJobs queues recovered jobs again from the start, keeping jobs of a batch together
+func resumeRecoveredJobs() {
+	jobsMutex.Lock()
+	recovered := recoveredJobs
+	recoveredJobs = nil
+	jobsMutex.Unlock()
+
+	batchIDs := map[string]string{}
+	defer func() {
+		for _, batchID := range batchIDs {
+			closeBatch(batchID)
+		}
+	}()
+
+	var failures []string
+	resumed := 0
+	for _, j := range recovered {
+		probe, err := detectWithFfprobe(j.InputPath)
+		if nil != err {
+			failures = append(failures, fmt.Sprintf("%s: %s", filepath.Base(j.InputPath), err))
+			continue
+		}
+
+		if _, ok := batchIDs[j.BatchID]; !ok {
+			batchIDs[j.BatchID] = newBatchID()
+		}
+
+		if _, err := submitJob(j.InputPath, probe, j.Settings, j.Preset, batchIDs[j.BatchID]); nil != err {
+			failures = append(failures, fmt.Sprintf("%s: %s", filepath.Base(j.InputPath), err))
+			continue
+		}
+		resumed++
+	}
+
+	recoveryHelperMsg = fmt.Sprintf("resumed %d job(s)", resumed)
+	if 0 < len(failures) {
+		recoveryHelperMsg += "\nfailed:\n" + strings.Join(failures, "\n")
+	}
+	if err := saveQueue(); nil != err {
+		recoveryHelperMsg += fmt.Sprintf("\nfailed to save queue: %s", err)
+	}
+}
+
+func discardRecoveredJobs() {
+	jobsMutex.Lock()
+	count := len(recoveredJobs)
+	recoveredJobs = nil
+	jobsMutex.Unlock()
+
+	recoveryHelperMsg = fmt.Sprintf("discarded %d job(s)", count)
+	if err := saveQueue(); nil != err {
+		recoveryHelperMsg += fmt.Sprintf("\nfailed to save queue: %s", err)
+	}
+}
+
+// removeOrphanedPartials deletes partial outputs left by last run
+func removeOrphanedPartials() {
+	jobsMutex.Lock()
+	partials := orphanedPartials
+	orphanedPartials = nil
+	jobsMutex.Unlock()
+
+	var failures []string
+	for _, path := range partials {
+		if err := os.Remove(path); nil != err && !os.IsNotExist(err) {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	recoveryHelperMsg = fmt.Sprintf("deleted %d partial file(s)", len(partials)-len(failures))
+	if 0 < len(failures) {
+		recoveryHelperMsg += "\nfailed:\n" + strings.Join(failures, "\n")
+	}
+}
+
+func recoveryLayouts() []g.Widget {
+	jobsMutex.Lock()
+	recovered := recoveredJobs
+	partials := orphanedPartials
+	jobsMutex.Unlock()
+
+	var widgets []g.Widget
+
+	if 0 < len(recovered) {
+		var names []string
+		for _, j := range recovered {
+			names = append(names, filepath.Base(j.InputPath))
+		}
+
+		widgets = append(widgets,
+			g.Label(fmt.Sprintf("%d job(s) left unfinished by last run: %s", len(recovered), strings.Join(names, ", "))).Wrapped(true),
+			g.Row(
+				g.Button("Resume").OnClick(func() {
+					go resumeRecoveredJobs()
+				}),
+				g.Button("Discard").OnClick(discardRecoveredJobs),
+			),
+		)
+	}
+
+	if 0 < len(partials) {
+		widgets = append(widgets,
+			g.Label(fmt.Sprintf("partial output left by last run:\n%s", strings.Join(partials, "\n"))).Wrapped(true),
+			// resumed job may be writing to the same partial path
+			g.Button("Delete partial files").OnClick(removeOrphanedPartials).Disabled(isCurrentlyConverting || isConversionPreparing),
+		)
+	}
+
+	if "" != recoveryHelperMsg {
+		widgets = append(widgets, g.Label(recoveryHelperMsg).Wrapped(true))
+	}
+
+	return widgets
+}
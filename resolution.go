@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+var aspectModeComboBoxLists = []string{
+	"fit",
+	"pad",
+	"crop",
+}
+var aspectModeComboBoxIdx int32 = 0
+var aspectModeToUse = "fit"
+
+var customWidth int32 = 1280
+var customHeight int32 = 720
+var neverUpscale bool
+
+// videoStream returns first video stream of probe, except attached pictures such as cover art
+func (o ffprobeOutput) videoStream() (int, bool) {
+	for i, stream := range o.Streams {
+		if "video" == stream.CodecType && 0 == stream.Disposition.AttachedPic {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// rotation returns clockwise rotation of first video stream, in degrees within [0, 360)
+func (o ffprobeOutput) rotation() int {
+	idx, ok := o.videoStream()
+	if !ok {
+		return 0
+	}
+
+	stream := o.Streams[idx]
+	rotation := 0
+	for _, sideData := range stream.SideDataList {
+		if "Display Matrix" == sideData.SideDataType {
+			// display matrix rotation is counterclockwise
+			rotation = -sideData.Rotation
+		}
+	}
+	if 0 == rotation && "" != stream.Tags.Rotate {
+		rotation, _ = strconv.Atoi(stream.Tags.Rotate)
+	}
+
+	return ((rotation % 360) + 360) % 360
+}
+
+// displaySize returns size of first video stream as it is displayed, that is, after rotation is applied.
+// ffmpeg rotates frames automatically before any filter, so filters see this size.
+func (o ffprobeOutput) displaySize() (int, int) {
+	idx, ok := o.videoStream()
+	if !ok {
+		return 0, 0
+	}
+
+	width, height := o.Streams[idx].Width, o.Streams[idx].Height
+	if 90 == o.rotation()%180 {
+		width, height = height, width
+	}
+
+	return width, height
+}
+
+func evenRound(v float64) int {
+	return int(math.Round(v/2)) * 2
+}
+
+// resolutionHeight returns target height of resolution preset such as "720p", 0 if it is not a preset
+func resolutionHeight(res string) int {
+	height, err := strconv.Atoi(strings.TrimSuffix(res, "p"))
+	if nil != err || !strings.HasSuffix(res, "p") {
+		return 0
+	}
+
+	return height
+}
+
+// targetBox returns width and height of the frame to fit into, for source of given display size.
+// Presets refer to the short side, so portrait videos get a portrait box.
+func targetBox(s conversionSettings, srcWidth, srcHeight int) (int, int) {
+	if "custom" == s.Resolution {
+		return int(s.CustomWidth), int(s.CustomHeight)
+	}
+
+	short := resolutionHeight(s.Resolution)
+	long := evenRound(float64(short) * 16 / 9)
+	if srcHeight > srcWidth {
+		return short, long
+	}
+
+	return long, short
+}
+
+// scaleFilter returns video filter chain scaling source of given display size, empty if nothing to do
+func scaleFilter(s conversionSettings, srcWidth, srcHeight int) string {
+	boxWidth, boxHeight := targetBox(s, srcWidth, srcHeight)
+	if 0 >= boxWidth || 0 >= boxHeight {
+		return ""
+	}
+
+	// source size is unknown, let ffmpeg scale it keeping aspect ratio
+	if 0 == srcWidth || 0 == srcHeight {
+		switch s.AspectMode {
+		case "pad":
+			return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1", boxWidth, boxHeight, boxWidth, boxHeight)
+		case "crop":
+			return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,setsar=1", boxWidth, boxHeight, boxWidth, boxHeight)
+		}
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", boxWidth, boxHeight)
+	}
+
+	widthRatio := float64(boxWidth) / float64(srcWidth)
+	heightRatio := float64(boxHeight) / float64(srcHeight)
+
+	var ratio float64
+	switch s.AspectMode {
+	case "crop":
+		ratio = math.Max(widthRatio, heightRatio)
+	default:
+		ratio = math.Min(widthRatio, heightRatio)
+		// presets keep old behavior, scaling short side to preset regardless of aspect ratio
+		if "fit" == s.AspectMode && "custom" != s.Resolution {
+			ratio = float64(resolutionHeight(s.Resolution)) / float64(srcWidth)
+			if srcHeight < srcWidth {
+				ratio = float64(resolutionHeight(s.Resolution)) / float64(srcHeight)
+			}
+		}
+	}
+
+	if s.NeverUpscale && 1 < ratio {
+		// letterboxing a small source into a bigger frame is upscaling as well
+		if "pad" == s.AspectMode {
+			return ""
+		}
+		ratio = 1
+	}
+
+	width, height := evenRound(float64(srcWidth)*ratio), evenRound(float64(srcHeight)*ratio)
+
+	var filters []string
+	if width != srcWidth || height != srcHeight {
+		filters = append(filters, fmt.Sprintf("scale=%d:%d", width, height))
+	}
+
+	switch s.AspectMode {
+	case "pad":
+		if width != boxWidth || height != boxHeight {
+			filters = append(filters, fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", boxWidth, boxHeight), "setsar=1")
+		}
+	case "crop":
+		cropWidth, cropHeight := boxWidth, boxHeight
+		if width < cropWidth {
+			cropWidth = width
+		}
+		if height < cropHeight {
+			cropHeight = height
+		}
+		if width != cropWidth || height != cropHeight {
+			filters = append(filters, fmt.Sprintf("crop=%d:%d", cropWidth, cropHeight), "setsar=1")
+		}
+	}
+
+	return strings.Join(filters, ",")
+}
+
+// customSizeError reports custom size ffmpeg cannot encode, odd sizes fail with yuv420p encoders such as libx264
+func customSizeError(s conversionSettings) error {
+	if "custom" != s.Resolution {
+		return nil
+	}
+	if 0 >= s.CustomWidth || 0 >= s.CustomHeight {
+		return fmt.Errorf("custom width and height should be positive")
+	}
+	if 0 != s.CustomWidth%2 || 0 != s.CustomHeight%2 {
+		return fmt.Errorf("custom width and height should be even")
+	}
+
+	return nil
+}
+
+// scaleFilterFor returns scaling video filter chain for videoPath according to s
+func scaleFilterFor(s conversionSettings, videoPath string) string {
+	if "original" == s.Resolution {
+		return ""
+	}
+
+	// crop and rotation come before scaling, so scaling sees frames after them
+	_, width, height := framingFilters(s, videoPath)
+	return scaleFilter(s, width, height)
+}
+
+func resolutionLayouts() []g.Widget {
+	var widgets []g.Widget
+
+	if "original" == resToUse {
+		return widgets
+	}
+
+	if "custom" == resToUse {
+		widgets = append(widgets, g.Row(
+			g.Label("size"),
+			g.Dummy(10, 0),
+			g.InputInt(&customWidth).Size(80),
+			g.Label("x"),
+			g.InputInt(&customHeight).Size(80),
+		))
+	}
+
+	widgets = append(widgets, g.Row(
+		g.Label("aspect"),
+		g.Dummy(10, 0),
+		g.Combo("##aspect", aspectModeComboBoxLists[aspectModeComboBoxIdx], aspectModeComboBoxLists, &aspectModeComboBoxIdx).Size(100).OnChange(func() {
+			aspectModeToUse = aspectModeComboBoxLists[aspectModeComboBoxIdx]
+		}),
+		g.Checkbox("never upscale", &neverUpscale),
+	))
+
+	return widgets
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var matchingSourceComboBoxLists = []string{
+	"convert anyway",
+	"remux",
+	"skip",
+}
+var matchingSourceComboBoxIdx int32 = 0
+var matchingSourceToUse = "convert anyway"
+
+var skipCodecComboBoxLists = []string{
+	"none",
+	"H.264",
+	"H.265",
+	"VP9",
+	"AV1",
+}
+var skipCodecComboBoxIdx int32 = 0
+var skipCodecToUse = "none"
+
+// codecNames maps codec choices on GUI to codec name ffprobe reports
+var codecNames = map[string]string{
+	"H.264":  "h264",
+	"H.265":  "hevc",
+	"VP9":    "vp9",
+	"AV1":    "av1",
+	"AAC":    "aac",
+	"OPUS":   "opus",
+	"VORBIS": "vorbis",
+}
+
+const (
+	planConvert = "convert"
+	planRemux   = "remux"
+	planSkip    = "skip"
+)
+
+// videoCodecName returns codec name of first video stream, empty if there is no video
+func (o ffprobeOutput) videoCodecName() string {
+	idx, ok := o.videoStream()
+	if !ok {
+		return ""
+	}
+
+	return o.Streams[idx].CodecName
+}
+
+// sourcePlan compares planned settings with source of videoPath, then returns whether it needs
+// to be converted, only remuxed (streams copied as is) or skipped, with explanation.
+// Only converting video is planned, other output modes are always converted.
+func sourcePlan(s conversionSettings, videoPath string) (string, string) {
+	if "convert video" != s.OutputMode {
+		return planConvert, ""
+	}
+
+	probe, ok := videoProbeOf(videoPath)
+	if !ok {
+		return planConvert, "source is not probed"
+	}
+
+	videoCodec := probe.videoCodecName()
+	if "none" != s.SkipCodec && codecNames[s.SkipCodec] == videoCodec {
+		return planSkip, fmt.Sprintf("already %s", s.SkipCodec)
+	}
+
+	if "convert anyway" == s.MatchingSource {
+		return planConvert, ""
+	}
+
+	var mismatches []string
+	if "original" != s.VideoCodec && codecNames[s.VideoCodec] != videoCodec {
+		mismatches = append(mismatches, fmt.Sprintf("video is %s, not %s", videoCodec, s.VideoCodec))
+	}
+	if audioCodec := probe.audioCodecName(); "original" != s.AudioCodec && "" != audioCodec && codecNames[s.AudioCodec] != audioCodec {
+		mismatches = append(mismatches, fmt.Sprintf("audio is %s, not %s", audioCodec, s.AudioCodec))
+	}
+	if "" != scaleFilterFor(s, videoPath) {
+		width, height := probe.displaySize()
+		mismatches = append(mismatches, fmt.Sprintf("%dx%d needs scaling", width, height))
+	}
+	if pixelFormatChanges(s, videoPath) {
+		mismatches = append(mismatches, fmt.Sprintf("pixel format is %s, not %s", probe.pixelFormat(), targetPixelFormat(s, videoPath)))
+	}
+	if isWebOptimizing(s, videoPath) && "H.264" == s.VideoCodec {
+		if mismatch := h264ConstraintMismatch(s, probe); "" != mismatch {
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+	if hasVideoFilters(s, videoPath) {
+		mismatches = append(mismatches, "video filters are applied")
+	}
+
+	planned := ffmpeg.KwArgs{}
+	frameRateKwargs(s, planned, videoPath)
+	if _, ok := planned["r"]; ok {
+		mismatches = append(mismatches, "frame rate changes")
+	}
+	audioKwargs(s, planned, videoPath)
+	for _, key := range []string{"filter:a", "ac", "ar"} {
+		if _, ok := planned[key]; ok {
+			mismatches = append(mismatches, "audio is processed")
+			break
+		}
+	}
+	if s.AdvancedMode {
+		mismatches = append(mismatches, "advanced options are given")
+	}
+
+	if 0 < len(mismatches) {
+		return planConvert, strings.Join(mismatches, ", ")
+	}
+
+	var changes []string
+	ext := strings.ToLower(filepath.Ext(videoPath))
+	if "original" != s.ContainerFormat && "."+s.ContainerFormat != ext {
+		changes = append(changes, fmt.Sprintf("container to %s", s.ContainerFormat))
+	}
+	if "strip all" == s.MetadataMode || "" != s.MetadataTitle || "" != s.MetadataArtist || "" != s.MetadataComment {
+		changes = append(changes, "metadata")
+	}
+	if isWebOptimizing(s, videoPath) && isMp4Path(videoPath) && cachedMoovAtEnd(videoPath) {
+		changes = append(changes, "moov atom position")
+	}
+
+	if "skip" == s.MatchingSource && 0 == len(changes) {
+		return planSkip, "already matches planned settings"
+	}
+
+	if 0 < len(changes) {
+		return planRemux, fmt.Sprintf("streams already match, only %s changes", strings.Join(changes, " and "))
+	}
+
+	return planRemux, "streams already match"
+}
+
+// remuxKwargs makes output kwargs copy every stream as is
+func remuxKwargs(args ffmpeg.KwArgs) {
+	args["c:v"] = "copy"
+	args["c:a"] = "copy"
+	delete(args, "b:a")
+	delete(args, "crf")
+	delete(args, "pix_fmt")
+	delete(args, "profile:v")
+	delete(args, "level:v")
+}
+
+// sourcePlanSummary returns plan of every video in list, one per line, empty when every video is simply converted
+func sourcePlanSummary(s conversionSettings) string {
+	var lines []string
+	explained := false
+
+	for _, videoPath := range listOfVideos {
+		plan, reason := sourcePlan(s, videoPath)
+		if planConvert != plan {
+			explained = true
+		}
+		if "" == reason {
+			lines = append(lines, fmt.Sprintf("%s: %s", filepath.Base(videoPath), plan))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %s (%s)", filepath.Base(videoPath), plan, reason))
+		}
+	}
+
+	if !explained {
+		return ""
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func smartLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Row(
+			g.Label("when source already matches"),
+			g.Combo("##matchingsource", matchingSourceComboBoxLists[matchingSourceComboBoxIdx], matchingSourceComboBoxLists, &matchingSourceComboBoxIdx).Size(130).OnChange(func() {
+				matchingSourceToUse = matchingSourceComboBoxLists[matchingSourceComboBoxIdx]
+			}),
+		),
+		g.Row(
+			g.Label("only convert files whose codec is not"),
+			g.Combo("##skipcodec", skipCodecComboBoxLists[skipCodecComboBoxIdx], skipCodecComboBoxLists, &skipCodecComboBoxIdx).Size(80).OnChange(func() {
+				skipCodecToUse = skipCodecComboBoxLists[skipCodecComboBoxIdx]
+			}),
+		),
+	}
+
+	if summary := sourcePlanSummary(currentSettings()); "" != summary {
+		widgets = append(widgets, g.Label(summary).Wrapped(true))
+	}
+
+	return widgets
+}
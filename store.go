@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	g "github.com/AllenDang/giu"
+
+	"github.com/kesuskim/video-converter/internal/util"
+)
+
+const (
+	storeKeyPreferences = "preferences"
+	storeKeyAPIToken    = "api_token"
+)
+
+// settingsStore keeps preferences and secrets encrypted with random key of key file, nil if it cannot be opened
+var settingsStore *util.Store
+
+// settingsStoreErr tells why settings store cannot be opened, GUI offers to reset it
+var settingsStoreErr error
+
+var resetSettings bool
+
+func settingsStorePath() string {
+	return filepath.Join(appDataDir(), "settings.enc")
+}
+
+func settingsKeyPath() string {
+	return filepath.Join(appDataDir(), "settings.key")
+}
+
+// openSettingsStore opens settings store and applies preferences saved on last conversion.
+// Without the store, application works as before but nothing is remembered.
+func openSettingsStore() error {
+	store, err := util.OpenKeyFileStore(settingsStorePath(), settingsKeyPath())
+	if nil != err {
+		return fmt.Errorf("settings are not remembered: %w", err)
+	}
+	settingsStore = store
+
+	if data, ok := store.Get(storeKeyPreferences); ok {
+		var s conversionSettings
+		if err := json.Unmarshal([]byte(data), &s); nil != err {
+			return fmt.Errorf("saved preferences are broken: %w", err)
+		}
+		applySettings(s)
+	}
+
+	return nil
+}
+
+// resetSettingsStore moves unreadable store and its key aside with .broken suffix, then starts with empty store
+func resetSettingsStore() error {
+	for _, path := range []string{settingsStorePath(), settingsKeyPath()} {
+		if err := os.Rename(path, path+".broken"); nil != err && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	settingsStore = nil
+	settingsStoreErr = openSettingsStore()
+
+	return settingsStoreErr
+}
+
+// savePreferences remembers s for next launch
+func savePreferences(s conversionSettings) error {
+	if nil == settingsStore {
+		return nil
+	}
+
+	data, err := json.Marshal(s)
+	if nil != err {
+		return err
+	}
+
+	return settingsStore.Set(storeKeyPreferences, string(data))
+}
+
+// storedAPIToken returns API token saved in settings store, empty if there is none
+func storedAPIToken() string {
+	if nil == settingsStore {
+		return ""
+	}
+
+	token, _ := settingsStore.Get(storeKeyAPIToken)
+	return token
+}
+
+func saveAPIToken(token string) error {
+	if nil == settingsStore {
+		return fmt.Errorf("settings store is not available")
+	}
+
+	return settingsStore.Set(storeKeyAPIToken, token)
+}
+
+func settingsStoreLayouts() []g.Widget {
+	if nil == settingsStoreErr {
+		return nil
+	}
+
+	return []g.Widget{
+		g.Label(settingsStoreErr.Error()).Wrapped(true),
+		g.Button("Reset settings").OnClick(func() {
+			if err := resetSettingsStore(); nil != err {
+				settingsStoreErr = fmt.Errorf("failed to reset settings: %w", err)
+			}
+		}),
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var streamingFormatComboBoxLists = []string{
+	"hls",
+	"dash",
+	"hls + dash",
+}
+var streamingFormatComboBoxIdx int32 = 0
+var streamingFormatToUse = "hls"
+
+var segmentDuration int32 = 6
+var streamingAudioBitrate int32 = 128
+
+// ladderRung is a single rendition of adaptive streaming package, built from a resolution preset
+type ladderRung struct {
+	Resolution string `json:"resolution"`
+	Enabled    bool   `json:"enabled"`
+	// Bitrate is video bitrate in kbps
+	Bitrate int32 `json:"bitrate"`
+}
+
+var streamingLadder = []ladderRung{
+	{"360p", true, 800},
+	{"480p", false, 1400},
+	{"720p", true, 2800},
+	{"1080p", true, 5000},
+	{"1440p", false, 8000},
+	{"2160p", false, 14000},
+}
+
+// rendition is a ladder rung resolved against a source
+type rendition struct {
+	name    string
+	width   int
+	height  int
+	bitrate int32
+}
+
+func isStreamingOutputMode(s conversionSettings) bool {
+	return "streaming" == s.OutputMode
+}
+
+// streamingOutputPath returns path of playlist or manifest given to ffmpeg, inside its own directory
+func streamingOutputPath(s conversionSettings, dir string) string {
+	if "hls" == s.StreamingFormat {
+		return filepath.ToSlash(filepath.Join(dir, "stream_%v.m3u8"))
+	}
+
+	return filepath.ToSlash(filepath.Join(dir, "manifest.mpd"))
+}
+
+// renditions returns enabled ladder rungs which are not above source resolution, lowest first.
+// When source is smaller than every enabled rung, a single rendition of source size is returned.
+func renditions(s conversionSettings, srcWidth, srcHeight int) ([]rendition, error) {
+	short := srcHeight
+	if srcWidth < srcHeight {
+		short = srcWidth
+	}
+
+	var ret []rendition
+	var lowest *ladderRung
+	for i := range s.StreamingLadder {
+		rung := s.StreamingLadder[i]
+		if !rung.Enabled {
+			continue
+		}
+		if 0 >= rung.Bitrate {
+			return nil, fmt.Errorf("bitrate of %s should be positive", rung.Resolution)
+		}
+		if nil == lowest {
+			lowest = &s.StreamingLadder[i]
+		}
+
+		height := resolutionHeight(rung.Resolution)
+		// source size is unknown, let ffmpeg keep aspect ratio
+		if 0 == short {
+			ret = append(ret, rendition{rung.Resolution, -2, height, rung.Bitrate})
+			continue
+		}
+		if height > short {
+			continue
+		}
+
+		ratio := float64(height) / float64(short)
+		ret = append(ret, rendition{rung.Resolution, evenRound(float64(srcWidth) * ratio), evenRound(float64(srcHeight) * ratio), rung.Bitrate})
+	}
+
+	if nil == lowest {
+		return nil, fmt.Errorf("enable at least one rendition")
+	}
+
+	if 0 == len(ret) {
+		ret = append(ret, rendition{fmt.Sprintf("%dp", short), evenRound(float64(srcWidth)), evenRound(float64(srcHeight)), lowest.Bitrate})
+	}
+
+	return ret, nil
+}
+
+// streamingKwargs returns output kwargs packaging videoPath into adaptive streaming renditions.
+// Every rendition is encoded from one decode with keyframes forced on segment boundaries,
+// so that players can switch between renditions at any segment.
+func streamingKwargs(s conversionSettings, videoPath, convertedPath string) (ffmpeg.KwArgs, error) {
+	if 0 >= s.SegmentDuration {
+		return nil, fmt.Errorf("segment duration should be positive")
+	}
+	if 0 >= s.StreamingAudioBitrate {
+		return nil, fmt.Errorf("audio bitrate should be positive")
+	}
+
+	probe, _ := videoProbeOf(videoPath)
+	width, height := probe.displaySize()
+	ladder, err := renditions(s, width, height)
+	if nil != err {
+		return nil, err
+	}
+
+	// without probe (e.g. preview of command), assume there is audio
+	hasAudio := "" != probe.audioCodecName() || 0 == len(probe.Streams)
+
+	args := ffmpeg.KwArgs{
+		"c:v":              "libx264",
+		"sc_threshold":     "0",
+		"force_key_frames": fmt.Sprintf("expr:gte(t,n_forced*%d)", s.SegmentDuration),
+	}
+
+	splitOutputs := ""
+	var filters, maps, streamMap []string
+	for i, r := range ladder {
+		splitOutputs += fmt.Sprintf("[s%d]", i)
+		filters = append(filters, fmt.Sprintf("[s%d]scale=%d:%d[v%s]", i, r.width, r.height, r.name))
+		maps = append(maps, fmt.Sprintf("[v%s]", r.name))
+
+		args[fmt.Sprintf("b:v:%d", i)] = fmt.Sprintf("%dk", r.bitrate)
+		args[fmt.Sprintf("maxrate:v:%d", i)] = fmt.Sprintf("%dk", r.bitrate*107/100)
+		args[fmt.Sprintf("bufsize:v:%d", i)] = fmt.Sprintf("%dk", r.bitrate*3/2)
+
+		if hasAudio {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,agroup:audio,name:%s", i, r.name))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,name:%s", i, r.name))
+		}
+	}
+	args["filter_complex"] = fmt.Sprintf("[0:v]split=%d%s;%s", len(ladder), splitOutputs, strings.Join(filters, ";"))
+
+	if hasAudio {
+		// audio is encoded once and shared by every rendition
+		maps = append(maps, "0:a:0")
+		streamMap = append([]string{"a:0,agroup:audio,name:audio"}, streamMap...)
+		args["c:a"] = "aac"
+		args["b:a"] = fmt.Sprintf("%dk", s.StreamingAudioBitrate)
+		audioKwargs(s, args, videoPath)
+	}
+	args["map"] = maps
+
+	frameRateKwargs(s, args, videoPath)
+
+	dir := filepath.Dir(convertedPath)
+	switch s.StreamingFormat {
+	case "hls":
+		args["f"] = "hls"
+		args["hls_time"] = strconv.Itoa(int(s.SegmentDuration))
+		args["hls_playlist_type"] = "vod"
+		args["hls_flags"] = "independent_segments"
+		args["hls_segment_filename"] = filepath.ToSlash(filepath.Join(dir, "stream_%v_%03d.ts"))
+		args["master_pl_name"] = "master.m3u8"
+		args["var_stream_map"] = strings.Join(streamMap, " ")
+	default:
+		args["f"] = "dash"
+		args["seg_duration"] = strconv.Itoa(int(s.SegmentDuration))
+		args["adaptation_sets"] = "id=0,streams=v"
+		if hasAudio {
+			args["adaptation_sets"] = "id=0,streams=v id=1,streams=a"
+		}
+		if "hls + dash" == s.StreamingFormat {
+			args["hls_playlist"] = "1"
+		}
+	}
+
+	return args, nil
+}
+
+// prepareStreamingOutput creates directory which playlists and segments are written into
+func prepareStreamingOutput(convertedPath string) error {
+	return os.MkdirAll(filepath.Dir(convertedPath), os.FileMode(0755))
+}
+
+func streamingLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Row(
+			g.Label("package"),
+			g.Dummy(10, 0),
+			g.Combo("##streamingformat", streamingFormatComboBoxLists[streamingFormatComboBoxIdx], streamingFormatComboBoxLists, &streamingFormatComboBoxIdx).Size(120).OnChange(func() {
+				streamingFormatToUse = streamingFormatComboBoxLists[streamingFormatComboBoxIdx]
+			}),
+		),
+		g.Row(
+			g.InputInt(&segmentDuration).Label("segment (s)").Size(80),
+			g.InputInt(&streamingAudioBitrate).Label("audio (kbps)").Size(80),
+		),
+		g.Label("renditions above source resolution are skipped"),
+	}
+
+	for i := range streamingLadder {
+		rung := &streamingLadder[i]
+		widgets = append(widgets, g.Row(
+			g.Checkbox(fmt.Sprintf("%s##rung%d", rung.Resolution, i), &rung.Enabled),
+			g.InputInt(&rung.Bitrate).Label(fmt.Sprintf("kbps##rungbitrate%d", i)).Size(100),
+		))
+	}
+
+	widgets = append(widgets, frameRateLayouts()...)
+
+	return widgets
+}
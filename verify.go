@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strings"
+
+	g "github.com/AllenDang/giu"
+)
+
+var verifyOutput = true
+var fullDecodeCheck bool
+var durationTolerance float32 = 1
+
+// decodeErrorLines is how many lines of decoder errors are kept on verification result
+const decodeErrorLines = 10
+
+// verification is result of checking output after conversion
+type verification struct {
+	Passed         bool     `json:"passed"`
+	SourceDuration float64  `json:"source_duration"`
+	OutputDuration float64  `json:"output_duration"`
+	FullDecode     bool     `json:"full_decode"`
+	Problems       []string `json:"problems,omitempty"`
+}
+
+// streamCounts returns number of video (except attached pictures), audio and subtitle streams
+func (o ffprobeOutput) streamCounts() map[string]int {
+	counts := map[string]int{}
+	for _, stream := range o.Streams {
+		if "video" == stream.CodecType && 0 != stream.Disposition.AttachedPic {
+			continue
+		}
+		counts[stream.CodecType]++
+	}
+
+	return counts
+}
+
+// isVerifiableOutput reports whether output of current mode is a single media file which can be compared to source
+func isVerifiableOutput(s conversionSettings, convertedPath string) bool {
+	return !isImageOutputMode(s) && !isStreamingOutputMode(s) && isSingleOutputFile(convertedPath)
+}
+
+// compareWithSource checks probe of output against probe of source, returns problems found
+func compareWithSource(s conversionSettings, source, output ffprobeOutput, checkDuration bool) []string {
+	var problems []string
+
+	sourceCounts := source.streamCounts()
+	outputCounts := output.streamCounts()
+
+	expected := map[string]bool{"video": 0 < sourceCounts["video"], "audio": 0 < sourceCounts["audio"]}
+	if "extract audio" == s.OutputMode {
+		expected["video"] = false
+	}
+
+	for _, codecType := range []string{"video", "audio"} {
+		if expected[codecType] && 0 == outputCounts[codecType] {
+			problems = append(problems, fmt.Sprintf("output has no %s stream", codecType))
+		}
+	}
+	// ffmpeg never adds streams by itself, more streams than source means output is not what it should be
+	for codecType, count := range outputCounts {
+		if count > sourceCounts[codecType] {
+			problems = append(problems, fmt.Sprintf("output has %d %s stream(s), source has %d", count, codecType, sourceCounts[codecType]))
+		}
+	}
+
+	if checkDuration {
+		expectedDuration, outputDuration := source.duration()/playbackSpeedFactor(s), output.duration()
+		if 0 >= outputDuration {
+			problems = append(problems, "output duration is unknown")
+		} else if 0 < expectedDuration && float64(s.DurationTolerance) < math.Abs(expectedDuration-outputDuration) {
+			problems = append(problems, fmt.Sprintf("output is %.2fs long, %.2fs is expected", outputDuration, expectedDuration))
+		}
+	}
+
+	return problems
+}
+
+// decodeCheck decodes whole output, returns errors printed by decoder
+func decodeCheck(convertedPath string) ([]string, string, string) {
+	var stderr bytes.Buffer
+
+	ffmpegCmd := exec.Command("ffmpeg", "-hide_banner", "-nostats", "-v", "error", "-i", convertedPath, "-f", "null", "-")
+	ffmpegCmd.Stderr = io.MultiWriter(&stderr, &convertingFFmpegOutput)
+
+	result, message := runFfmpegCmd(ffmpegCmd, convertedPath)
+	if historyResultSuccess != result && historyResultFailed != result {
+		return nil, result, message
+	}
+
+	var problems []string
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if "" == strings.TrimSpace(line) {
+			continue
+		}
+		if decodeErrorLines <= len(problems) {
+			problems = append(problems, "...")
+			break
+		}
+		problems = append(problems, fmt.Sprintf("decode: %s", line))
+	}
+	if historyResultFailed == result && 0 == len(problems) {
+		problems = append(problems, fmt.Sprintf("decode: %s", message))
+	}
+
+	return problems, historyResultSuccess, ""
+}
+
+// verifyConversion re-probes output of videoPath and compares it with source, then decodes it fully if enabled.
+// Returned result and message are not success only when verification itself is cancelled.
+func verifyConversion(s conversionSettings, videoPath, convertedPath string) (verification, string, string) {
+	source, _ := videoProbeOf(videoPath)
+	ret := verification{
+		SourceDuration: source.duration(),
+		FullDecode:     s.FullDecodeCheck,
+	}
+
+	output, err := detectWithFfprobe(convertedPath)
+	if nil != err {
+		ret.Problems = append(ret.Problems, fmt.Sprintf("output cannot be probed: %s", err))
+		return ret, historyResultSuccess, ""
+	}
+	ret.OutputDuration = output.duration()
+
+	// cutting options may be given in advanced options, duration cannot be expected then
+	ret.Problems = append(ret.Problems, compareWithSource(s, source, output, !s.AdvancedMode)...)
+
+	if s.FullDecodeCheck {
+		convertingHelperMsg = fmt.Sprintf("verifying by decoding:\n %s", convertedPath)
+
+		problems, result, message := decodeCheck(convertedPath)
+		if historyResultSuccess != result {
+			return ret, result, message
+		}
+		ret.Problems = append(ret.Problems, problems...)
+	}
+
+	ret.Passed = 0 == len(ret.Problems)
+
+	return ret, historyResultSuccess, ""
+}
+
+func verifyLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Checkbox("verify output (duration and streams)", &verifyOutput),
+	}
+
+	if verifyOutput {
+		widgets = append(widgets, g.Row(
+			g.InputFloat(&durationTolerance).Label("tolerance (s)").Format("%.1f").Size(60),
+			g.Checkbox("full decode check", &fullDecodeCheck),
+		))
+	}
+
+	return widgets
+}
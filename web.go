@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	g "github.com/AllenDang/giu"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+var webOptimized bool
+
+var h264ProfileComboBoxLists = []string{
+	"any",
+	"baseline",
+	"main",
+	"high",
+}
+var h264ProfileComboBoxIdx int32 = 0
+var h264ProfileToUse = "any"
+
+var h264LevelComboBoxLists = []string{
+	"any",
+	"3.0",
+	"3.1",
+	"4.0",
+	"4.1",
+	"4.2",
+	"5.1",
+}
+var h264LevelComboBoxIdx int32 = 0
+var h264LevelToUse = "any"
+
+var moovChecksMutex sync.Mutex
+var moovChecks = map[string]bool{}
+
+var isFixingFaststart bool
+var faststartHelperMsg string
+
+// isMp4Path reports whether path is in mp4 family container, which can have moov atom at the front
+func isMp4Path(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v", ".mov":
+		return true
+	}
+
+	return false
+}
+
+// moovAtEnd reads top level atoms of mp4 file, reports whether media data comes before moov atom,
+// which makes players download whole file before starting
+func moovAtEnd(path string) (bool, error) {
+	f, err := os.Open(path)
+	if nil != err {
+		return false, err
+	}
+	defer f.Close()
+
+	var header [16]byte
+	var offset int64
+	for {
+		if _, err := f.ReadAt(header[:8], offset); nil != err {
+			if io.EOF == err {
+				return false, fmt.Errorf("moov atom not found")
+			}
+			return false, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		switch string(header[4:8]) {
+		case "moov":
+			return false, nil
+		case "mdat":
+			return true, nil
+		}
+
+		switch size {
+		case 0:
+			// atom extends to end of file
+			return false, fmt.Errorf("moov atom not found")
+		case 1:
+			if _, err := f.ReadAt(header[8:16], offset+8); nil != err {
+				return false, err
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if 8 > size {
+			return false, fmt.Errorf("invalid atom size %d at %d", size, offset)
+		}
+
+		offset += size
+	}
+}
+
+// cachedMoovAtEnd returns moovAtEnd of path, checked once as GUI asks it on every frame
+func cachedMoovAtEnd(path string) bool {
+	moovChecksMutex.Lock()
+	defer moovChecksMutex.Unlock()
+
+	atEnd, ok := moovChecks[path]
+	if !ok {
+		atEnd, _ = moovAtEnd(path)
+		moovChecks[path] = atEnd
+	}
+
+	return atEnd
+}
+
+func forgetMoovCheck(path string) {
+	moovChecksMutex.Lock()
+	delete(moovChecks, path)
+	moovChecksMutex.Unlock()
+}
+
+// isWebOptimizing reports whether output of videoPath is made web optimized
+func isWebOptimizing(s conversionSettings, videoPath string) bool {
+	return s.WebOptimized && "convert video" == s.OutputMode && isMp4Path(convertedPathFor(s, videoPath))
+}
+
+// webKwargs moves moov atom to the front and constrains H.264 profile and level, for mp4 output.
+// Returned warnings describe constraints which cannot be met.
+func webKwargs(s conversionSettings, args ffmpeg.KwArgs, videoPath string) []string {
+	if !isWebOptimizing(s, videoPath) {
+		return nil
+	}
+
+	args["movflags"] = "+faststart"
+
+	if "H.264" != s.VideoCodec {
+		return nil
+	}
+
+	var warnings []string
+	if "any" != s.H264Profile {
+		args["profile:v"] = s.H264Profile
+		if pixFmt, _ := args["pix_fmt"].(string); "" != pixFmt && "yuv420p" != pixFmt {
+			warnings = append(warnings, fmt.Sprintf("H.264 %s profile supports only 8-bit 4:2:0, choose compatible pixel format", s.H264Profile))
+		}
+	}
+	if "any" != s.H264Level {
+		args["level:v"] = s.H264Level
+	}
+
+	return warnings
+}
+
+// h264ConstraintMismatch returns how H.264 source of probe breaks profile and level constraints, empty if it does not
+func h264ConstraintMismatch(s conversionSettings, probe ffprobeOutput) string {
+	idx, ok := probe.videoStream()
+	if !ok || "h264" != probe.Streams[idx].CodecName {
+		return ""
+	}
+	stream := probe.Streams[idx]
+
+	// profiles are ordered, a source in lower profile plays wherever higher one does
+	profiles := map[string]int{"baseline": 0, "constrained baseline": 0, "main": 1, "high": 2}
+	if "any" != s.H264Profile {
+		if profile, ok := profiles[strings.ToLower(stream.Profile)]; !ok || profile > profiles[s.H264Profile] {
+			return fmt.Sprintf("profile is %s, not %s", stream.Profile, s.H264Profile)
+		}
+	}
+
+	if "any" != s.H264Level {
+		level, _ := strconv.ParseFloat(s.H264Level, 64)
+		if 0 >= stream.Level || float64(stream.Level) > level*10+0.5 {
+			return fmt.Sprintf("level is %.1f, not %s", float64(stream.Level)/10, s.H264Level)
+		}
+	}
+
+	return ""
+}
+
+// fixFaststart remuxes videoPath with moov atom at the front, without re-encoding, then replaces it
+func fixFaststart(videoPath string) error {
+	ext := filepath.Ext(videoPath)
+	tmpPath := filepath.Join(filepath.Dir(videoPath), fmt.Sprintf(".%s.faststart%s", strings.TrimSuffix(filepath.Base(videoPath), ext), ext))
+
+	output, err := exec.Command("ffmpeg",
+		"-hide_banner", "-v", "error",
+		"-i", videoPath,
+		"-map", "0",
+		"-c", "copy",
+		"-map_metadata", "0",
+		"-movflags", "+faststart",
+		"-y", tmpPath,
+	).CombinedOutput()
+	if nil != err {
+		os.Remove(tmpPath)
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	if atEnd, err := moovAtEnd(tmpPath); nil != err || atEnd {
+		os.Remove(tmpPath)
+		return fmt.Errorf("moov atom is still not at the front")
+	}
+
+	return os.Rename(tmpPath, videoPath)
+}
+
+// fixFaststartVideos fixes every given video one by one
+func fixFaststartVideos(videoPaths []string) {
+	isFixingFaststart = true
+	defer func() {
+		isFixingFaststart = false
+		g.Update()
+	}()
+
+	var failures []string
+	for i, videoPath := range videoPaths {
+		faststartHelperMsg = fmt.Sprintf("moving moov atom to the front (%d/%d):\n %s", i+1, len(videoPaths), videoPath)
+
+		if err := fixFaststart(videoPath); nil != err {
+			failures = append(failures, fmt.Sprintf("%s: %s", filepath.Base(videoPath), err))
+		}
+		forgetMoovCheck(videoPath)
+	}
+
+	faststartHelperMsg = fmt.Sprintf("moved moov atom to the front of %d file(s)", len(videoPaths)-len(failures))
+	if 0 < len(failures) {
+		faststartHelperMsg += "\nfailed:\n" + strings.Join(failures, "\n")
+	}
+}
+
+// moovAtEndVideos returns mp4 videos in list whose moov atom is at the end
+func moovAtEndVideos() []string {
+	var ret []string
+
+	for _, videoPath := range listOfVideos {
+		if isMp4Path(videoPath) && cachedMoovAtEnd(videoPath) {
+			ret = append(ret, videoPath)
+		}
+	}
+
+	return ret
+}
+
+func webLayouts() []g.Widget {
+	widgets := []g.Widget{
+		g.Checkbox("web optimized (moov atom at the front of mp4)", &webOptimized),
+	}
+
+	if webOptimized && "H.264" == videoCodecToUse {
+		widgets = append(widgets, g.Row(
+			g.Label("H.264 profile"),
+			g.Combo("##h264profile", h264ProfileComboBoxLists[h264ProfileComboBoxIdx], h264ProfileComboBoxLists, &h264ProfileComboBoxIdx).Size(90).OnChange(func() {
+				h264ProfileToUse = h264ProfileComboBoxLists[h264ProfileComboBoxIdx]
+			}),
+			g.Label("level"),
+			g.Combo("##h264level", h264LevelComboBoxLists[h264LevelComboBoxIdx], h264LevelComboBoxLists, &h264LevelComboBoxIdx).Size(60).OnChange(func() {
+				h264LevelToUse = h264LevelComboBoxLists[h264LevelComboBoxIdx]
+			}),
+		))
+	}
+
+	if videos := moovAtEndVideos(); 0 < len(videos) {
+		var names []string
+		for _, videoPath := range videos {
+			names = append(names, filepath.Base(videoPath))
+		}
+
+		widgets = append(widgets, g.Label(fmt.Sprintf("moov atom at the end, slow to start on web: %s", strings.Join(names, ", "))).Wrapped(true), g.Button("Fix in place (remux, no re-encoding)").OnClick(func() {
+			go fixFaststartVideos(videos)
+		}).Disabled(isFixingFaststart || isCurrentlyConverting))
+	}
+
+	if "" != faststartHelperMsg {
+		widgets = append(widgets, g.Label(faststartHelperMsg).Wrapped(true))
+	}
+
+	return widgets
+}